@@ -0,0 +1,195 @@
+//-----------------------------------------------------------------------------
+// audit.go
+// nyacom (C) 2018.05
+// Append-only audit log of mutating operations (JSON lines)
+// The log (AUDIT_LOG_PATH, -audit-log) is rotated to .1 .. .AUDIT_LOG_KEEP by size
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"time"
+	"bufio"
+	"strings"
+	"strconv"
+	"encoding/json"
+)
+
+type AuditEntry struct {
+	Ts        time.Time	`json:"ts"`
+	Proto     string	`json:"proto"`			// text, framed, jsonrpc, grpc
+	Addr      string	`json:"addr"`
+	Identity  string	`json:"identity,omitempty"`
+	Cmd       string	`json:"cmd"`
+	Args      []string	`json:"args,omitempty"`
+	BitSha256 string	`json:"bit_sha256,omitempty"`	// Bitstream hash as in the bitstream record (PROG only)
+	BitSize   int		`json:"bit_size,omitempty"`
+	Duration  float64	`json:"duration"`		// sec
+	Result    string	`json:"result"`			// "ok" or error code
+	Msg       string	`json:"msg,omitempty"`
+}
+
+var (
+	audit_mu       sync.Mutex
+	audit_log_path = AUDIT_LOG_PATH
+)
+
+//-----------------------------------------------------------------------------
+// Record
+//-----------------------------------------------------------------------------
+// Forced RELEASE is a read command, but overrides the lease of another client
+func audit_forced(cmd string, args []string) bool {
+	return cmd == TERM_CMD_RELEASE && len(args) > 0 && args[0] == "force"
+}
+
+func audit_record(s *Session, cmd string, args []string, data []byte, t1 time.Time, err error) {
+	if !cmd_is_mutating(cmd) && !audit_forced(cmd, args) {
+		return
+	}
+
+	e := AuditEntry{
+		Ts:       t1,
+		Proto:    s.Proto,
+		Addr:     s.Addr,
+		Identity: s.Identity,
+		Cmd:      cmd,
+		Args:     args,
+		Duration: time.Now().Sub(t1).Seconds(),
+		Result:   "ok",
+	}
+	if cmd_is_prog(cmd) && len(data) > 0 {
+		e.BitSize = len(data)
+		if bin, _, err := bitstream_parse(data); err == nil {
+			e.BitSha256 = bitstream_sha256(bin)
+		}
+	}
+	if err != nil {
+		fe := fic_error_of(err)
+		e.Result = fe.Code
+		e.Msg = fe.Msg
+	}
+
+	if err := audit_write(e); err != nil {
+		fmt.Println("ERROR: Audit log", err)
+	}
+}
+
+func audit_write(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	audit_mu.Lock()
+	defer audit_mu.Unlock()
+
+	audit_rotate()
+
+	f, err := os.OpenFile(audit_log_path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Rotate by size (audit_mu must be held)
+func audit_rotate() {
+	st, err := os.Stat(audit_log_path)
+	if err != nil || st.Size() < AUDIT_LOG_MAXSIZE {
+		return
+	}
+
+	for i := AUDIT_LOG_KEEP - 1; i >= 1; i-- {
+		os.Rename(audit_path(i), audit_path(i + 1))
+	}
+	if err := os.Rename(audit_log_path, audit_path(1)); err != nil {
+		fmt.Println("ERROR: Audit log rotate", err)
+	}
+}
+
+func audit_path(i int) string {
+	if i == 0 {
+		return audit_log_path
+	}
+	return audit_log_path + "." + strconv.Itoa(i)
+}
+
+//-----------------------------------------------------------------------------
+// Query
+// filters: cmd=<CMD> who=<identity or address> result=<ok|code>
+//          since=<RFC3339> until=<RFC3339>
+//-----------------------------------------------------------------------------
+func audit_query(n int, filters []string)(res []AuditEntry, err error) {
+	match := []func(e *AuditEntry) bool{}
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fic_error(ERR_BAD_ARGS, "Bad audit filter " + f)
+		}
+		k, v := kv[0], kv[1]
+		switch k {
+		case "cmd":
+			match = append(match, func(e *AuditEntry) bool { return strings.EqualFold(e.Cmd, v) })
+		case "who":
+			match = append(match, func(e *AuditEntry) bool {
+				return e.Identity == v || e.Addr == v || strings.HasPrefix(e.Addr, v + ":")
+			})
+		case "result":
+			match = append(match, func(e *AuditEntry) bool { return e.Result == v })
+		case "since", "until":
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fic_error(ERR_BAD_ARGS, "Bad audit time " + v)
+			}
+			if k == "since" {
+				match = append(match, func(e *AuditEntry) bool { return !e.Ts.Before(t) })
+			} else {
+				match = append(match, func(e *AuditEntry) bool { return e.Ts.Before(t) })
+			}
+		default:
+			return nil, fic_error(ERR_BAD_ARGS, "Unknown audit filter " + k)
+		}
+	}
+
+	audit_mu.Lock()
+	defer audit_mu.Unlock()
+
+	// Oldest rotated file first
+	for i := AUDIT_LOG_KEEP; i >= 0; i-- {
+		f, err := os.Open(audit_path(i))
+		if err != nil {
+			continue
+		}
+
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	next:
+		for sc.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(sc.Bytes(), &e) != nil {
+				continue
+			}
+			for _, m := range match {
+				if !m(&e) {
+					continue next
+				}
+			}
+			res = append(res, e)
+			if n > 0 && len(res) > n {
+				res = res[1:]
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fic_errorf(ERR_INTERNAL, "Audit log %s: %v", audit_path(i), err)
+		}
+	}
+
+	return res, nil
+}
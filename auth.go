@@ -0,0 +1,308 @@
+//-----------------------------------------------------------------------------
+// auth.go
+// nyacom (C) 2018.05
+// Token authentication and role based authorization
+//
+// Policy file (AUTH_CONFIG_PATH, JSON)
+//  {
+//    "anonymous": "read",              // Role without AUTH ("" for none)
+//    "tokens": [
+//      {"sha256": "<hex of token>", "identity": "alice", "role": "admin"}
+//    ],
+//    "certs": [                        // TLS client certificate subjects
+//      {"subject": "CN=bob,O=lab", "identity": "bob", "role": "operator"}
+//    ],
+//    "commands": {"WAIT": "operator"}  // Optional override of default policy
+//  }
+// Without the policy file at startup authentication is disabled and every
+// client is admin. A policy file missing on reload (SIGHUP) is an error, the
+// current policy is kept.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"strings"
+	"context"
+	"sync/atomic"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+)
+
+//-----------------------------------------------------------------------------
+// Roles
+//-----------------------------------------------------------------------------
+const (
+	ROLE_NONE     = 0
+	ROLE_READ     = 1
+	ROLE_OPERATOR = 2
+	ROLE_ADMIN    = 3
+)
+
+var role_names = map[string]int {
+	"":         ROLE_NONE,
+	"none":     ROLE_NONE,
+	"read":     ROLE_READ,
+	"operator": ROLE_OPERATOR,
+	"admin":    ROLE_ADMIN,
+}
+
+func role_name(role int) string {
+	switch role {
+	case ROLE_READ:
+		return "read"
+	case ROLE_OPERATOR:
+		return "operator"
+	case ROLE_ADMIN:
+		return "admin"
+	}
+	return "none"
+}
+
+// Default required role per command
+var auth_default_policy = map[string]int {
+	TERM_CMD_HELP:     ROLE_NONE,
+	TERM_CMD_CAPS:     ROLE_NONE,
+	TERM_CMD_AUTH:     ROLE_NONE,
+	TERM_CMD_WHO:      ROLE_NONE,
+	TERM_CMD_AUDIT:    ROLE_READ,
+	TERM_CMD_QUEUE:    ROLE_READ,
+
+	TERM_CMD_STAT:     ROLE_READ,
+	TERM_CMD_READ:     ROLE_READ,
+	TERM_CMD_READ16:   ROLE_READ,
+	TERM_CMD_READ32:   ROLE_READ,
+	TERM_CMD_READ64:   ROLE_READ,
+	TERM_CMD_WAIT:     ROLE_READ,
+
+	TERM_CMD_RELEASE:  ROLE_READ,	// Own lease only, force requires admin
+
+	TERM_CMD_WRITE:    ROLE_OPERATOR,
+	TERM_CMD_WRITE16:  ROLE_OPERATOR,
+	TERM_CMD_WRITE32:  ROLE_OPERATOR,
+	TERM_CMD_WRITE64:  ROLE_OPERATOR,
+	TERM_CMD_SETBITS:  ROLE_OPERATOR,
+	TERM_CMD_CLRBITS:  ROLE_OPERATOR,
+	TERM_CMD_RMW:      ROLE_OPERATOR,
+	TERM_CMD_RESET:    ROLE_OPERATOR,
+	TERM_CMD_START:    ROLE_OPERATOR,
+	TERM_CMD_RESERVE:  ROLE_OPERATOR,	// A lease locks out every other client
+	TERM_CMD_RENEW:    ROLE_OPERATOR,
+
+	TERM_CMD_PROG:     ROLE_ADMIN,
+	TERM_CMD_PROG_PR:  ROLE_ADMIN,
+	TERM_CMD_PROG8:    ROLE_ADMIN,
+	TERM_CMD_PROG8_PR: ROLE_ADMIN,
+	TERM_CMD_INIT:     ROLE_ADMIN,
+}
+
+//-----------------------------------------------------------------------------
+// Client session (one per connection)
+//-----------------------------------------------------------------------------
+type Session struct {
+	Proto    string	// text, framed, jsonrpc, grpc
+	Addr     string	// Remote address
+	Id       uint64	// Connection serial
+	Identity string	// Authenticated identity ("" for anonymous)
+	Role     int
+
+	Ctx      context.Context	// Canceled on disconnect
+	Close    context.CancelFunc
+	Queued   func(pos int)		// Called when an operation is queued
+}
+
+var session_serial uint64
+
+func session_new(addr string)(*Session) {
+	auth_mu.RLock()
+	defer auth_mu.RUnlock()
+
+	if addr == "" {
+		addr = "unix"
+	}
+
+	s := &Session{Addr: addr, Id: atomic.AddUint64(&session_serial, 1), Role: ROLE_ADMIN}
+	if auth_conf != nil {
+		s.Role = role_names[auth_conf.Anonymous]
+	}
+	s.Ctx, s.Close = context.WithCancel(daemon_ctx)
+	go func() {
+		<-s.Ctx.Done()
+		lease_session_end(s)
+	} ()
+	return s
+}
+
+// Identity for logs (identity or remote address)
+func (s *Session) Who() string {
+	if s.Identity != "" {
+		return s.Identity
+	}
+	return s.Addr
+}
+
+//-----------------------------------------------------------------------------
+// Policy
+//-----------------------------------------------------------------------------
+type AuthToken struct {
+	Sha256   string	`json:"sha256"`
+	Identity string	`json:"identity"`
+	Role     string	`json:"role"`
+}
+
+type AuthCert struct {
+	Subject  string	`json:"subject"`	// RFC 2253 form of client certificate subject
+	Identity string	`json:"identity"`
+	Role     string	`json:"role"`
+}
+
+type AuthConf struct {
+	Anonymous string			`json:"anonymous"`
+	Tokens    []AuthToken			`json:"tokens"`
+	Certs     []AuthCert			`json:"certs"`
+	Commands  map[string]string		`json:"commands"`
+}
+
+var (
+	auth_mu   sync.RWMutex
+	auth_conf *AuthConf	// nil for authentication disabled
+)
+
+// Load policy file, keep current policy on error
+func auth_load(path string, reload bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		auth_mu.Lock()
+		defer auth_mu.Unlock()
+		if reload && auth_conf != nil {
+			return fic_error(ERR_BAD_ARGS, "auth policy " + path + " is missing, keeping the current policy")
+		}
+		fmt.Println("WARNING: No auth policy", path, "(authentication disabled)")
+		auth_conf = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	conf := &AuthConf{}
+	if err := json.NewDecoder(f).Decode(conf); err != nil {
+		return fic_error(ERR_JSON, "auth policy: " + err.Error())
+	}
+
+	// Validate roles
+	if _, ok := role_names[conf.Anonymous]; !ok {
+		return fic_error(ERR_BAD_ARGS, "auth policy: unknown role " + conf.Anonymous)
+	}
+	for _, t := range conf.Tokens {
+		if _, ok := role_names[t.Role]; !ok {
+			return fic_error(ERR_BAD_ARGS, "auth policy: unknown role " + t.Role)
+		}
+	}
+	for _, c := range conf.Certs {
+		if _, ok := role_names[c.Role]; !ok {
+			return fic_error(ERR_BAD_ARGS, "auth policy: unknown role " + c.Role)
+		}
+	}
+	for _, r := range conf.Commands {
+		if _, ok := role_names[r]; !ok {
+			return fic_error(ERR_BAD_ARGS, "auth policy: unknown role " + r)
+		}
+	}
+
+	auth_mu.Lock()
+	auth_conf = conf
+	auth_mu.Unlock()
+
+	fmt.Println("FiCDaemon: Auth policy loaded", path, len(conf.Tokens), "tokens")
+	return nil
+}
+
+// Authenticate session with token
+func auth_login(s *Session, token string) error {
+	auth_mu.RLock()
+	defer auth_mu.RUnlock()
+
+	if auth_conf == nil {
+		s.Role = ROLE_ADMIN
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range auth_conf.Tokens {
+		want, err := hex.DecodeString(t.Sha256)
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			s.Identity = t.Identity
+			s.Role = role_names[t.Role]
+			fmt.Println("DEBUG: AUTH", s.Identity, "from", s.Addr)
+			return nil
+		}
+	}
+
+	fmt.Println("DEBUG: AUTH FAILED from", s.Addr)
+	return fic_error(ERR_AUTH_FAILED, "Invalid token")
+}
+
+// Authenticate session with verified TLS client certificate
+func auth_login_cert(s *Session, cert *x509.Certificate) error {
+	auth_mu.RLock()
+	defer auth_mu.RUnlock()
+
+	subject := cert.Subject.String()
+	if auth_conf == nil {
+		s.Identity = subject
+		return nil
+	}
+
+	for _, c := range auth_conf.Certs {
+		if c.Subject == subject {
+			s.Identity = c.Identity
+			s.Role = role_names[c.Role]
+			fmt.Println("DEBUG: AUTH CERT", s.Identity, "from", s.Addr)
+			return nil
+		}
+	}
+
+	fmt.Println("DEBUG: AUTH CERT UNKNOWN", subject, "from", s.Addr)
+	return fic_error(ERR_AUTH_FAILED, "Unknown client certificate " + subject)
+}
+
+// Check if session has the role
+func auth_check_role(s *Session, need int, what string) error {
+	if s.Role >= need {
+		return nil
+	}
+	if s.Identity == "" {
+		return fic_error(ERR_AUTH_REQUIRED, what + " requires authentication")
+	}
+	return fic_error(ERR_FORBIDDEN, what + " is not allowed for " + s.Identity)
+}
+
+// Check if session may run the command
+func auth_check(s *Session, cmd string) error {
+	auth_mu.RLock()
+	defer auth_mu.RUnlock()
+
+	if auth_conf == nil {
+		return nil
+	}
+
+	need, ok := auth_default_policy[cmd]
+	if !ok {
+		need = ROLE_ADMIN	// Unknown and future commands
+	}
+	if r, ok := auth_conf.Commands[strings.ToUpper(cmd)]; ok {
+		need = role_names[r]
+	}
+
+	return auth_check_role(s, need, cmd)
+}
@@ -0,0 +1,231 @@
+//-----------------------------------------------------------------------------
+// bitstream.go
+// nyacom (C) 2018.05
+// Identity of the last programmed bitstream
+//
+// Each successful configuration is recorded in the state file
+// (BITSTREAM_STATE_PATH, -state) and reported in STAT, so the loaded design
+// is known after a daemon restart. The record is invalidated by INIT, by the
+// start of a full configuration, and when DONE is found low.
+// PROG data may be a .bit file, the header is recorded then. The client may
+// give the file name, it is recorded as is.
+// Partials of a PR base are recorded in its partitions (pr.go). Without the
+// PR config the last partial is recorded with the loaded base (partial).
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"time"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"./selectmap"
+)
+
+type BitRecord struct {
+	Sha256     string		`json:"sha256"`		// Of the configuration data (.bin)
+	Size       int			`json:"size"`
+	Name       string		`json:"name,omitempty"`	// File name given by the client
+	Bit        *selectmap.BitInfo	`json:"bit,omitempty"`	// .bit header
+	Width      int			`json:"width"`		// SelectMAP x8, x16
+	PR         bool			`json:"pr"`		// Unchecked partial (alone if the base is unknown)
+	Programmed time.Time		`json:"programmed"`
+	Client     string		`json:"client"`
+
+	Base       string		`json:"base,omitempty"`		// Name in PR config
+	Partitions map[string]*PrLoaded	`json:"partitions,omitempty"`	// Not modified in place
+	Partial    *BitRecord		`json:"partial,omitempty"`	// Last unchecked partial on this base
+}
+
+var (
+	bitstream_mu   sync.Mutex
+	bitstream      *BitRecord	// nil if unknown
+	bitstream_path = BITSTREAM_STATE_PATH
+)
+
+// Current record (copy), nil if unknown
+func bitstream_current()(*BitRecord) {
+	bitstream_mu.Lock()
+	defer bitstream_mu.Unlock()
+
+	if bitstream == nil {
+		return nil
+	}
+	r := *bitstream
+	return &r
+}
+
+// Read the state file at startup
+func bitstream_load() {
+	b, err := ioutil.ReadFile(bitstream_path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("ERROR: Bitstream state", err)
+		}
+		return
+	}
+
+	var r *BitRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		fmt.Println("ERROR: Bitstream state", bitstream_path, err)
+		return
+	}
+
+	bitstream_mu.Lock()
+	bitstream = r
+	bitstream_mu.Unlock()
+	if r != nil {
+		fmt.Println("DEBUG: BITSTREAM", r.Sha256, "programmed", r.Programmed, "by", r.Client)
+	}
+}
+
+// Replace the record and write the state file (bitstream_mu must be held)
+func bitstream_save(r *BitRecord) {
+	bitstream = r
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(bitstream_path), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(bitstream_path + ".tmp", b, 0644)
+	}
+	if err == nil {
+		err = os.Rename(bitstream_path + ".tmp", bitstream_path)
+	}
+	if err != nil {
+		fmt.Println("ERROR: Bitstream state", err)
+	}
+}
+
+func bitstream_invalidate(reason string) {
+	bitstream_mu.Lock()
+	defer bitstream_mu.Unlock()
+
+	if bitstream == nil {
+		return
+	}
+	fmt.Println("DEBUG: BITSTREAM INVALIDATED", reason)
+	bitstream_save(nil)
+}
+
+// Called with the DONE pin on every status
+func bitstream_check_done(done uint8) {
+	if done == 0 {
+		bitstream_invalidate("DONE low")
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Program data (.bit or .bin) and record it
+//-----------------------------------------------------------------------------
+func bitstream_parse(data []byte)(bin []byte, info *selectmap.BitInfo, err error) {
+	if !selectmap.Is_bit(data) {
+		return data, nil, nil
+	}
+
+	bin, bi, err := selectmap.Parse_bit(data)
+	if err != nil {
+		return nil, nil, fic_error(ERR_BAD_ARGS, "Invalid .bit file: " + err.Error())
+	}
+	return bin, &bi, nil
+}
+
+// Hash of the configuration data (.bin), recorded and audited
+func bitstream_sha256(bin []byte) string {
+	sum := sha256.Sum256(bin)
+	return hex.EncodeToString(sum[:])
+}
+
+func prog_record(ctx context.Context, who string, name string, data []byte, width int, prMode bool) error {
+	if len(name) > BITSTREAM_NAME_MAX {
+		return fic_errorf(ERR_BAD_ARGS, "File name longer than %d", BITSTREAM_NAME_MAX)
+	}
+	bin, info, err := bitstream_parse(data)
+	if err != nil {
+		return err
+	}
+
+	hash := bitstream_sha256(bin)
+
+	// Partial must match the loaded base
+	// Full configuration clears the loaded design, also on failure
+	var part string
+	var mod *PrModule
+	if prMode {
+		if part, mod, err = pr_check(hash); err != nil {
+			return err
+		}
+	} else {
+		bitstream_invalidate("PROG")
+		link_reset()
+	}
+
+	if width == 8 {
+		err = Prog8(ctx, bin, prMode)
+	} else {
+		err = Prog16(ctx, bin, prMode)
+	}
+
+	if part != "" {
+		if err != nil {
+			pr_record(part, nil)
+			return err
+		}
+		fmt.Println("DEBUG: PR", part, "module", mod.Name)
+		pr_record(part, &PrLoaded{Module: mod.Name, Sha256: hash, Programmed: time.Now(), Client: who})
+		return nil
+	}
+	if err != nil {
+		if prMode {
+			bitstream_partial(nil)
+		}
+		return err
+	}
+
+	r := &BitRecord{
+		Sha256: hash,
+		Size: len(bin),
+		Name: name,
+		Bit: info,
+		Width: width,
+		PR: prMode,
+		Programmed: time.Now(),
+		Client: who,
+	}
+	if prMode {
+		bitstream_partial(r)
+		return nil
+	}
+	r.Base, r.Partitions = pr_base(r)
+
+	bitstream_mu.Lock()
+	bitstream_save(r)
+	bitstream_mu.Unlock()
+
+	return nil
+}
+
+// Record an unchecked partial with the loaded base, nil if the partial failed
+// The partial is recorded alone if the base is unknown.
+func bitstream_partial(p *BitRecord) {
+	bitstream_mu.Lock()
+	defer bitstream_mu.Unlock()
+
+	switch {
+	case bitstream != nil && !bitstream.PR:
+		r := *bitstream
+		r.Partial = p
+		bitstream_save(&r)
+	case p != nil:
+		bitstream_save(p)
+	case bitstream != nil:
+		bitstream_save(nil)
+	}
+}
@@ -0,0 +1,310 @@
+//-----------------------------------------------------------------------------
+// client.go
+// nyacom (C) 2018.05
+// Client for the FiC daemon (framed protocol)
+//
+// The daemon sends "OK\r\n" on connect, the client answers FRAME_MAGIC and
+// FRAME_HELLO, then sends FRAME_REQ (cmdlen uint16, cmd, data) per command.
+// See frame.go of the daemon for the frame layout.
+//-----------------------------------------------------------------------------
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+	"bufio"
+	"errors"
+	"strings"
+	"context"
+	"sync/atomic"
+	"crypto/tls"
+	"encoding/binary"
+)
+
+//-----------------------------------------------------------------------------
+const (
+	DEFAULT_PORT    = "4000"
+	DIAL_TIMEOUT    = 10	// sec
+
+	FRAME_MAGIC     = "FICF"
+	FRAME_VERSION   = 1
+	FRAME_HDRSIZE   = 4 + 1 + 4
+	FRAME_MAXSIZE   = (256*1024*1024)
+	PROGRESS_CHUNK  = 64*1024
+
+	POOL_MAX_IDLE   = 4	// Idle connections kept by Pool
+	POOL_RETRY      = 3	// Retries on connection error
+	POOL_BACKOFF    = 200	// msec, doubled each retry
+
+	FRAME_HELLO  = 0x01
+	FRAME_REQ    = 0x02
+	FRAME_RESP   = 0x03
+	FRAME_ERR    = 0x04
+	FRAME_CANCEL = 0x05
+	FRAME_QUEUED = 0x06
+)
+
+var ErrProtocol = errors.New("unexpected response from daemon")
+
+//-----------------------------------------------------------------------------
+// Error reported by the daemon (FRAME_ERR)
+//-----------------------------------------------------------------------------
+type Error struct {
+	Num  uint16	// Numeric code
+	Code string	// e.g. "lock_timeout"
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+func parse_error(payload []byte) error {
+	if len(payload) < 2 {
+		return ErrProtocol
+	}
+	e := &Error{Num: binary.BigEndian.Uint16(payload[0:2])}
+	msg := string(payload[2:])
+	if i := strings.Index(msg, ": "); i >= 0 {
+		e.Code, e.Msg = msg[:i], msg[i+2:]
+	} else {
+		e.Msg = msg
+	}
+	return e
+}
+
+//-----------------------------------------------------------------------------
+type Options struct {
+	Token   string		// AUTH after connect
+	TLS     *tls.Config	// nil: plain TCP
+	Timeout time.Duration	// Dial timeout
+}
+
+type Client struct {
+	Addr     string
+	Version  string		// DAEMON_VERSION
+	Queued   func(pos int)	// Called when a request waits in the hardware queue
+	Progress func(sent int, total int)	// Called while sending request data
+
+	conn   net.Conn
+	r      *bufio.Reader
+	mu     sync.Mutex	// One request at a time
+	wmu    sync.Mutex
+	seq    uint32
+	broken int32		// Connection error, not reusable (atomic, read by Pool)
+}
+
+// host or host:port
+func Dial(addr string, opts Options)(*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DEFAULT_PORT)
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DIAL_TIMEOUT * time.Second
+	}
+
+	var conn net.Conn
+	var err error
+	d := &net.Dialer{Timeout: timeout}
+	if opts.TLS != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, opts.TLS)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{Addr: addr, conn: conn, r: bufio.NewReader(conn)}
+	if err := c.hello(timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if opts.Token != "" {
+		if _, err := c.Do("AUTH " + opts.Token, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	c.set_broken()
+	return c.conn.Close()
+}
+
+// Connection is lost or out of sync with the daemon
+func (c *Client) Broken() bool {
+	return atomic.LoadInt32(&c.broken) != 0
+}
+
+func (c *Client) set_broken() {
+	atomic.StoreInt32(&c.broken, 1)
+}
+
+// Prompt and version handshake
+func (c *Client) hello(timeout time.Duration) error {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(line) != "OK" {
+		return ErrProtocol
+	}
+
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, FRAME_VERSION)
+	if _, err := c.conn.Write([]byte(FRAME_MAGIC)); err != nil {
+		return err
+	}
+	if err := c.write(FRAME_HELLO, 0, payload, nil); err != nil {
+		return err
+	}
+
+	typ, _, payload, err := c.read()
+	if err != nil {
+		return err
+	}
+	if typ == FRAME_ERR {
+		return parse_error(payload)
+	}
+	if typ != FRAME_HELLO || len(payload) < 2 {
+		return ErrProtocol
+	}
+	c.Version = string(payload[2:])
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Frames
+//-----------------------------------------------------------------------------
+func (c *Client) write(typ uint8, id uint32, payload []byte, progress func(int, int)) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	hdr := make([]byte, FRAME_HDRSIZE)
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(FRAME_HDRSIZE - 4 + len(payload)))
+	hdr[4] = typ
+	binary.BigEndian.PutUint32(hdr[5:9], id)
+
+	if progress == nil {
+		_, err := c.conn.Write(append(hdr, payload...))
+		return err
+	}
+
+	if _, err := c.conn.Write(hdr); err != nil {
+		return err
+	}
+	for sent := 0; sent < len(payload); {
+		n := len(payload) - sent
+		if n > PROGRESS_CHUNK {
+			n = PROGRESS_CHUNK
+		}
+		if _, err := c.conn.Write(payload[sent:sent+n]); err != nil {
+			return err
+		}
+		sent += n
+		progress(sent, len(payload))
+	}
+	return nil
+}
+
+func (c *Client) read()(typ uint8, id uint32, payload []byte, err error) {
+	hdr := make([]byte, FRAME_HDRSIZE)
+	if _, err = io.ReadFull(c.r, hdr); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	if size < FRAME_HDRSIZE - 4 || size > FRAME_MAXSIZE {
+		return 0, 0, nil, ErrProtocol
+	}
+	payload = make([]byte, size - (FRAME_HDRSIZE - 4))
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return hdr[4], binary.BigEndian.Uint32(hdr[5:9]), payload, nil
+}
+
+//-----------------------------------------------------------------------------
+// Requests
+//-----------------------------------------------------------------------------
+// Execute one command, data is the binary payload (PROG)
+func (c *Client) Do(cmd string, data []byte)([]byte, error) {
+	return c.DoContext(context.Background(), cmd, data)
+}
+
+// Canceling ctx sends FRAME_CANCEL, the daemon then answers "canceled"
+func (c *Client) DoContext(ctx context.Context, cmd string, data []byte)([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	id := c.seq
+
+	payload := make([]byte, 2, 2 + len(cmd) + len(data))
+	binary.BigEndian.PutUint16(payload, uint16(len(cmd)))
+	payload = append(payload, cmd...)
+	payload = append(payload, data...)
+
+	var progress func(int, int)
+	if c.Progress != nil && len(data) > 0 {
+		head := 2 + len(cmd)
+		progress = func(sent int, total int) {
+			if sent -= head; sent > 0 {
+				c.Progress(sent, len(data))
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.write(FRAME_CANCEL, id, nil, nil)
+		case <-done:
+		}
+	} ()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.write(FRAME_REQ, id, payload, progress); err != nil {
+		c.set_broken()
+		return nil, err
+	}
+
+	for {
+		typ, rid, payload, err := c.read()
+		if err != nil {
+			c.set_broken()
+			return nil, err
+		}
+		if rid != id {
+			continue	// Stale response of a canceled request
+		}
+
+		switch typ {
+		case FRAME_RESP:
+			return payload, nil
+		case FRAME_ERR:
+			return nil, parse_error(payload)
+		case FRAME_QUEUED:
+			if c.Queued != nil && len(payload) >= 4 {
+				c.Queued(int(binary.BigEndian.Uint32(payload)))
+			}
+		default:
+			c.set_broken()
+			return nil, ErrProtocol
+		}
+	}
+}
@@ -0,0 +1,367 @@
+//-----------------------------------------------------------------------------
+// commands.go
+// nyacom (C) 2018.05
+// Typed wrappers of daemon commands
+// Each command has a variant taking context.Context (canceled by FRAME_CANCEL)
+//-----------------------------------------------------------------------------
+package client
+
+import (
+	"io"
+	"io/ioutil"
+	"fmt"
+	"time"
+	"context"
+	"strconv"
+	"strings"
+	"encoding/json"
+)
+
+// Board reservation (RESERVE, RENEW, WHO)
+type Lease struct {
+	Owner  string		`json:"owner"`
+	Since  time.Time	`json:"since"`
+	Expire time.Time	`json:"expire"`
+}
+
+// Audit log entry (AUDIT)
+type AuditEntry struct {
+	Ts        time.Time	`json:"ts"`
+	Proto     string	`json:"proto"`
+	Addr      string	`json:"addr"`
+	Identity  string	`json:"identity,omitempty"`
+	Cmd       string	`json:"cmd"`
+	Args      []string	`json:"args,omitempty"`
+	BitSha256 string	`json:"bit_sha256,omitempty"`
+	BitSize   int		`json:"bit_size,omitempty"`
+	Duration  float64	`json:"duration"`
+	Result    string	`json:"result"`
+	Msg       string	`json:"msg,omitempty"`
+}
+
+func (c *Client) do_json(ctx context.Context, cmd string, v interface{}) error {
+	resp, err := c.DoContext(ctx, cmd, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp, v)
+}
+
+func (c *Client) do_hex(ctx context.Context, cmd string, bits int)(uint64, error) {
+	resp, err := c.DoContext(ctx, cmd, nil)
+	if err != nil {
+		return 0, err
+	}
+	f := strings.Fields(string(resp))
+	if len(f) == 0 {
+		return 0, ErrProtocol
+	}
+	return strconv.ParseUint(f[0], 16, bits)
+}
+
+//-----------------------------------------------------------------------------
+// Status
+//-----------------------------------------------------------------------------
+// FicStat of the daemon
+type Status struct {
+	Ts     time.Time	`json:"ts"`
+	State  uint8		`json:"state"`
+	Hls    uint8		`json:"hls"`
+	Linkup uint8		`json:"linkup"`
+	Dipsw  uint8		`json:"dipsw"`
+	Led    uint8		`json:"led"`
+	Chup   uint8		`json:"chup"`
+	Done   uint8		`json:"done"`
+	Pwr    uint8		`json:"pwr"`
+	Ports  []Port		`json:"ports"`
+	Bitstream *Bitstream	`json:"bitstream"`	// Last programmed, nil if unknown
+}
+
+// Identity of the last programmed bitstream
+type Bitstream struct {
+	Sha256     string	`json:"sha256"`		// Of the configuration data
+	Size       int		`json:"size"`
+	Name       string	`json:"name,omitempty"`	// File name given by the client
+	Bit        *BitInfo	`json:"bit,omitempty"`	// .bit header
+	Width      int		`json:"width"`
+	PR         bool		`json:"pr"`		// Unchecked partial (alone if the base is unknown)
+	Programmed time.Time	`json:"programmed"`
+	Client     string	`json:"client"`
+
+	Base       string		`json:"base,omitempty"`	// PR base name
+	Partitions map[string]*Module	`json:"partitions,omitempty"`	// nil module if unknown
+	Partial    *Bitstream		`json:"partial,omitempty"`	// Last unchecked partial on this base
+}
+
+// Module loaded in a PR partition
+type Module struct {
+	Module     string	`json:"module"`
+	Sha256     string	`json:"sha256"`
+	Programmed time.Time	`json:"programmed"`
+	Client     string	`json:"client"`
+}
+
+type BitInfo struct {
+	Design string	`json:"design,omitempty"`
+	Part   string	`json:"part,omitempty"`
+	Date   string	`json:"date,omitempty"`
+	Time   string	`json:"time,omitempty"`
+	Size   int	`json:"size"`
+}
+
+// Link state of port N (bit N of Linkup and Chup)
+type Port struct {
+	Port     int		`json:"port"`
+	Link     bool		`json:"link"`
+	Chup     bool		`json:"chup"`
+	Since    time.Time	`json:"since"`		// Last change
+	Changes  int		`json:"changes"`
+	Flapping bool		`json:"flapping"`
+}
+
+// Port n, decoded from Linkup and Chup if the daemon does not report ports
+func (st *Status) Port(n int)(Port) {
+	if n < len(st.Ports) {
+		return st.Ports[n]
+	}
+	return Port{
+		Port: n,
+		Link: st.Linkup & (1 << uint(n)) != 0,
+		Chup: st.Chup & (1 << uint(n)) != 0,
+	}
+}
+
+func (c *Client) Status()(*Status, error) {
+	return c.StatusContext(context.Background())
+}
+
+func (c *Client) StatusContext(ctx context.Context)(*Status, error) {
+	var st Status
+	if err := c.do_json(ctx, "STAT", &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+//-----------------------------------------------------------------------------
+// Registers
+//-----------------------------------------------------------------------------
+func (c *Client) Read8(addr uint16)(uint8, error) {
+	return c.Read8Context(context.Background(), addr)
+}
+
+func (c *Client) Read8Context(ctx context.Context, addr uint16)(uint8, error) {
+	v, err := c.do_hex(ctx, fmt.Sprintf("READ %x", addr), 8)
+	return uint8(v), err
+}
+
+func (c *Client) Write8(addr uint16, data uint8) error {
+	return c.Write8Context(context.Background(), addr, data)
+}
+
+func (c *Client) Write8Context(ctx context.Context, addr uint16, data uint8) error {
+	_, err := c.DoContext(ctx, fmt.Sprintf("WRITE %x %x", addr, data), nil)
+	return err
+}
+
+// Register option for ReadN and WriteN
+const (
+	REG_LE    = "le"	// Little endian (default)
+	REG_BE    = "be"	// Big endian
+	REG_LATCH = "latch"	// Atomic latch convention
+)
+
+func reg_cmd(op string, width int)(string, error) {
+	switch width {
+	case 8:
+		return op, nil
+	case 16, 32, 64:
+		return op + strconv.Itoa(width), nil
+	}
+	return "", fmt.Errorf("invalid register width %d", width)
+}
+
+// Read width bit register (8, 16, 32, 64)
+func (c *Client) ReadN(addr uint16, width int, opts ...string)(uint64, error) {
+	return c.ReadNContext(context.Background(), addr, width, opts...)
+}
+
+func (c *Client) ReadNContext(ctx context.Context, addr uint16, width int, opts ...string)(uint64, error) {
+	cmd, err := reg_cmd("READ", width)
+	if err != nil {
+		return 0, err
+	}
+	if width == 8 {
+		opts = nil
+	}
+	return c.do_hex(ctx, strings.Join(append([]string{cmd, fmt.Sprintf("%x", addr)}, opts...), " "), width)
+}
+
+// Write width bit register (8, 16, 32, 64)
+func (c *Client) WriteN(addr uint16, width int, data uint64, opts ...string) error {
+	return c.WriteNContext(context.Background(), addr, width, data, opts...)
+}
+
+func (c *Client) WriteNContext(ctx context.Context, addr uint16, width int, data uint64, opts ...string) error {
+	cmd, err := reg_cmd("WRITE", width)
+	if err != nil {
+		return err
+	}
+	if width == 8 {
+		opts = nil
+	}
+	_, err = c.DoContext(ctx, strings.Join(append([]string{cmd, fmt.Sprintf("%x", addr), fmt.Sprintf("%x", data)}, opts...), " "), nil)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+// FPGA and user module control
+//-----------------------------------------------------------------------------
+// SelectMAP width
+type Mode int
+
+const (
+	X8  Mode = 8
+	X16 Mode = 16
+)
+
+func prog_cmd(mode Mode, pr bool)(string, error) {
+	switch {
+	case mode == X16 && !pr:
+		return "PROG", nil
+	case mode == X16 && pr:
+		return "PROGPR", nil
+	case mode == X8 && !pr:
+		return "PROG8", nil
+	case mode == X8 && pr:
+		return "PROG8PR", nil
+	}
+	return "", fmt.Errorf("invalid mode %d", mode)
+}
+
+// Configure FPGA with .bin data, or a .bit file (the daemon records the header)
+func (c *Client) Program(r io.Reader, mode Mode, pr bool) error {
+	return c.ProgramContext(context.Background(), r, mode, pr)
+}
+
+func (c *Client) ProgramContext(ctx context.Context, r io.Reader, mode Mode, pr bool) error {
+	return c.ProgramNamedContext(ctx, r, mode, pr, "")
+}
+
+// name is recorded by the daemon with the bitstream, e.g. the file base name
+// (blanks are replaced by '_')
+func (c *Client) ProgramNamedContext(ctx context.Context, r io.Reader, mode Mode, pr bool, name string) error {
+	cmd, err := prog_cmd(mode, pr)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("%s %d", cmd, len(data))
+	if name = strings.Join(strings.Fields(name), "_"); name != "" {
+		line += " " + name
+	}
+	_, err = c.DoContext(ctx, line, data)
+	return err
+}
+
+func (c *Client) Init() error {
+	return c.InitContext(context.Background())
+}
+
+func (c *Client) InitContext(ctx context.Context) error {
+	_, err := c.DoContext(ctx, "INIT", nil)
+	return err
+}
+
+func (c *Client) Reset() error {
+	return c.ResetContext(context.Background())
+}
+
+func (c *Client) ResetContext(ctx context.Context) error {
+	_, err := c.DoContext(ctx, "RESET", nil)
+	return err
+}
+
+func (c *Client) Start() error {
+	return c.StartContext(context.Background())
+}
+
+func (c *Client) StartContext(ctx context.Context) error {
+	_, err := c.DoContext(ctx, "START", nil)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+// Reservation
+//-----------------------------------------------------------------------------
+// sec 0 is the daemon default
+func (c *Client) Reserve(sec int)(*Lease, error) {
+	return c.ReserveContext(context.Background(), sec)
+}
+
+func (c *Client) ReserveContext(ctx context.Context, sec int)(*Lease, error) {
+	var l Lease
+	if err := c.do_json(ctx, fmt.Sprintf("RESERVE %d", sec), &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (c *Client) Renew(sec int)(*Lease, error) {
+	return c.RenewContext(context.Background(), sec)
+}
+
+func (c *Client) RenewContext(ctx context.Context, sec int)(*Lease, error) {
+	var l Lease
+	if err := c.do_json(ctx, fmt.Sprintf("RENEW %d", sec), &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// force releases other's reservation (admin)
+func (c *Client) Release(force bool) error {
+	return c.ReleaseContext(context.Background(), force)
+}
+
+func (c *Client) ReleaseContext(ctx context.Context, force bool) error {
+	cmd := "RELEASE"
+	if force {
+		cmd += " force"
+	}
+	_, err := c.DoContext(ctx, cmd, nil)
+	return err
+}
+
+// nil if the board is free
+func (c *Client) Who()(*Lease, error) {
+	return c.WhoContext(context.Background())
+}
+
+func (c *Client) WhoContext(ctx context.Context)(*Lease, error) {
+	var l *Lease
+	if err := c.do_json(ctx, "WHO", &l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+//-----------------------------------------------------------------------------
+// Audit log, filters are "key=value" (cmd, who, result, since, until)
+//-----------------------------------------------------------------------------
+func (c *Client) Audit(n int, filters ...string)([]AuditEntry, error) {
+	return c.AuditContext(context.Background(), n, filters...)
+}
+
+func (c *Client) AuditContext(ctx context.Context, n int, filters ...string)([]AuditEntry, error) {
+	var res []AuditEntry
+	cmd := strings.Join(append([]string{"AUDIT", strconv.Itoa(n)}, filters...), " ")
+	if err := c.do_json(ctx, cmd, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
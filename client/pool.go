@@ -0,0 +1,183 @@
+//-----------------------------------------------------------------------------
+// pool.go
+// nyacom (C) 2018.05
+// Connection pool of one daemon with retry
+//
+// Requests are retried on connection errors (lost connection, refused,
+// protocol error) with a new connection. Errors reported by the daemon
+// (*Error) and canceled contexts are returned as is.
+// Once a request was sent the daemon may have executed it, so only
+// idempotent calls (DoIdempotent: STAT, READ) are retried after that.
+//-----------------------------------------------------------------------------
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+	"bytes"
+	"errors"
+	"context"
+	"io/ioutil"
+)
+
+var ErrPoolClosed = errors.New("client pool is closed")
+
+type Pool struct {
+	Addr    string
+	Opts    Options
+	MaxIdle int		// Idle connections kept
+	Retry   int		// Retries on connection error
+	Backoff time.Duration	// Wait before the first retry
+
+	mu     sync.Mutex
+	idle   []*Client
+	closed bool
+}
+
+func NewPool(addr string, opts Options)(*Pool) {
+	return &Pool{
+		Addr: addr,
+		Opts: opts,
+		MaxIdle: POOL_MAX_IDLE,
+		Retry: POOL_RETRY,
+		Backoff: POOL_BACKOFF * time.Millisecond,
+	}
+}
+
+// Idle connection or a new one
+func (p *Pool) Get(ctx context.Context)(*Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	return Dial(p.Addr, p.Opts)
+}
+
+// Return c to the pool, broken connections are closed
+func (p *Pool) Put(c *Client) {
+	c.Queued, c.Progress = nil, nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.Broken() || p.closed || len(p.idle) >= p.MaxIdle {
+		c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+	p.closed = true
+}
+
+// Connection errors are retried, daemon errors are not
+func retryable(err error) bool {
+	if _, ok := err.(*Error); ok {
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF || err == ErrProtocol
+}
+
+//-----------------------------------------------------------------------------
+// Run fn with a pooled connection, retried on connection error until fn
+// sent a request (dial and handshake errors)
+//-----------------------------------------------------------------------------
+func (p *Pool) Do(ctx context.Context, fn func(c *Client) error) error {
+	return p.do(ctx, fn, false)
+}
+
+// Also retried after the request was sent, fn must be idempotent
+// Note: fn may be called more than once
+func (p *Pool) DoIdempotent(ctx context.Context, fn func(c *Client) error) error {
+	return p.do(ctx, fn, true)
+}
+
+func (p *Pool) do(ctx context.Context, fn func(c *Client) error, idempotent bool) error {
+	backoff := p.Backoff
+	for i := 0; ; i++ {
+		sent := false
+		c, err := p.Get(ctx)
+		if err == nil {
+			seq := c.seq
+			err = fn(c)
+			sent = c.seq != seq
+			p.Put(c)
+		}
+		if err == nil || !retryable(err) || (sent && !idempotent) || i >= p.Retry || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Typed commands
+//-----------------------------------------------------------------------------
+func (p *Pool) Status(ctx context.Context)(st *Status, err error) {
+	err = p.DoIdempotent(ctx, func(c *Client) (err error) {
+		st, err = c.StatusContext(ctx)
+		return err
+	})
+	return st, err
+}
+
+func (p *Pool) Read8(ctx context.Context, addr uint16)(v uint8, err error) {
+	err = p.DoIdempotent(ctx, func(c *Client) (err error) {
+		v, err = c.Read8Context(ctx, addr)
+		return err
+	})
+	return v, err
+}
+
+func (p *Pool) Write8(ctx context.Context, addr uint16, data uint8) error {
+	return p.Do(ctx, func(c *Client) error {
+		return c.Write8Context(ctx, addr, data)
+	})
+}
+
+// r is read once, the data is resent on retry (before it was sent)
+func (p *Pool) Program(ctx context.Context, r io.Reader, mode Mode, pr bool) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return p.Do(ctx, func(c *Client) error {
+		return c.ProgramContext(ctx, bytes.NewReader(data), mode, pr)
+	})
+}
+
+func (p *Pool) Init(ctx context.Context) error {
+	return p.Do(ctx, func(c *Client) error {
+		return c.InitContext(ctx)
+	})
+}
@@ -0,0 +1,294 @@
+//-----------------------------------------------------------------------------
+// client_test.go
+// nyacom (C) 2018.05
+// Client library against the daemon running in-process on a simulated board
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+	"bytes"
+	"context"
+	"testing"
+	"path/filepath"
+	"encoding/binary"
+	"./gpio"
+	"./client"
+	"./ficsim"
+)
+
+// Daemon accept loop on a simulated FiC board
+type test_daemon struct {
+	addr  string
+	board *ficsim.Board
+	mon   FicStat
+
+	mu    sync.Mutex
+	l     net.Listener
+	conns []net.Conn
+}
+
+func test_daemon_start(t *testing.T)(*test_daemon) {
+	dir := t.TempDir()
+	bitstream_path = filepath.Join(dir, "bitstream.json")
+	audit_log_path = filepath.Join(dir, "audit.log")
+
+	d := &test_daemon{board: ficsim.New()}
+	gpio.Setup_sim(d.board)
+
+	var err error
+	if d.mon, err = monitor_get_status_sched(context.Background(), "test", PRIO_BACKGROUND); err != nil {
+		t.Fatal("status:", err)
+	}
+
+	if err := d.listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.stop)
+	return d
+}
+
+func (d *test_daemon) listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.l, d.addr = l, l.Addr().String()
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			d.mu.Lock()
+			d.conns = append(d.conns, conn)
+			d.mu.Unlock()
+			go monitor_sock_conn(conn, &d.mon)
+		}
+	}()
+	return nil
+}
+
+// Close the connections, the listener keeps accepting
+func (d *test_daemon) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.conns {
+		c.Close()
+	}
+	d.conns = nil
+}
+
+func (d *test_daemon) stop() {
+	d.mu.Lock()
+	d.l.Close()
+	d.mu.Unlock()
+	d.drop()
+}
+
+// Configuration data with sync word and DESYNC (DONE on the simulated board)
+func test_bitstream()([]byte) {
+	var b bytes.Buffer
+	b.Write(bytes.Repeat([]byte{0xff}, 16))
+	for _, w := range []uint32{0x000000bb, 0x11220044, 0xffffffff, ficsim.SYNC_WORD,
+		0x20000000, 0x30008001, 0x00000007, 0x20000000,
+		ficsim.DESYNC_CMD, ficsim.DESYNC_VALUE, 0x20000000, 0x20000000} {
+		binary.Write(&b, binary.BigEndian, w)
+	}
+	return b.Bytes()
+}
+
+//-----------------------------------------------------------------------------
+// Client
+//-----------------------------------------------------------------------------
+func TestClientCommands(t *testing.T) {
+	d := test_daemon_start(t)
+
+	c, err := client.Dial(d.addr, client.Options{})
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	if c.Version != DAEMON_VERSION {
+		t.Errorf("version %q, want %q", c.Version, DAEMON_VERSION)
+	}
+
+	st, err := c.Status()
+	if err != nil {
+		t.Fatal("status:", err)
+	}
+	if st.Linkup != 0xff || st.Done != 0 {
+		t.Errorf("status linkup %02x done %d, want ff 0", st.Linkup, st.Done)
+	}
+
+	// Register access
+	if err := c.Write8(0x1234, 0x5a); err != nil {
+		t.Fatal("write8:", err)
+	}
+	if v := d.board.Get_reg(0x1234); v != 0x5a {
+		t.Errorf("board register %02x, want 5a", v)
+	}
+	d.board.Set_reg(0x1235, 0xa5)
+	if v, err := c.Read8(0x1235); err != nil || v != 0xa5 {
+		t.Errorf("read8 %02x %v, want a5", v, err)
+	}
+
+	// Configuration
+	if err := c.ProgramNamedContext(context.Background(), bytes.NewReader(test_bitstream()), client.X16, false, "top base.bin"); err != nil {
+		t.Fatal("program:", err)
+	}
+	if d.board.Loads != 1 {
+		t.Errorf("board loads %d, want 1", d.board.Loads)
+	}
+	if st, err = c.Status(); err != nil || st.Done != 1 || st.Bitstream == nil {
+		t.Fatalf("status after program %+v %v, want done 1 with bitstream", st, err)
+	}
+	if st.Bitstream.Name != "top_base.bin" {
+		t.Errorf("bitstream name %q, want top_base.bin", st.Bitstream.Name)
+	}
+
+	if err := c.Init(); err != nil {
+		t.Fatal("init:", err)
+	}
+	if st, err = c.Status(); err != nil || st.Done != 0 || st.Bitstream != nil {
+		t.Errorf("status after init %+v %v, want done 0 without bitstream", st, err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	d := test_daemon_start(t)
+
+	c, err := client.Dial(d.addr, client.Options{})
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+
+	// x16 needs even size
+	err = c.Program(bytes.NewReader([]byte{1, 2, 3}), client.X16, false)
+	e, ok := err.(*client.Error)
+	if !ok || e.Code != ERR_BAD_ARGS || e.Num != fic_err_num[ERR_BAD_ARGS] {
+		t.Errorf("program odd size: %v, want %s", err, ERR_BAD_ARGS)
+	}
+
+	// The connection is usable after an error
+	if _, err := c.Status(); err != nil {
+		t.Error("status after error:", err)
+	}
+}
+
+// RESET and START pulse the bits given by -reset-bit and -start-bit only
+func TestClientModuleBits(t *testing.T) {
+	d := test_daemon_start(t)
+	defer func() {
+		fic_st_reset, fic_st_start = 0, 0
+	}()
+
+	c, err := client.Dial(d.addr, client.Options{})
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+
+	for name, fn := range map[string]func() error{"reset": c.Reset, "start": c.Start} {
+		e, ok := fn().(*client.Error)
+		if !ok || e.Code != ERR_NOT_CONFIGURED {
+			t.Errorf("%s without bit: %v, want %s", name, e, ERR_NOT_CONFIGURED)
+		}
+	}
+
+	fic_st_reset, fic_st_start = 0x01, 0x02
+	d.board.Set_reg(FIC_REG_ST, 0x80)
+	if err := c.Reset(); err != nil {
+		t.Error("reset:", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Error("start:", err)
+	}
+	if v := d.board.Get_reg(FIC_REG_ST); v != 0x80 {
+		t.Errorf("FIC_REG_ST %02x after pulses, want 80", v)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Pool
+//-----------------------------------------------------------------------------
+func test_pool(addr string)(*client.Pool) {
+	p := client.NewPool(addr, client.Options{})
+	p.Retry = 5
+	p.Backoff = 10 * time.Millisecond
+	return p
+}
+
+func TestPoolRetryIdempotent(t *testing.T) {
+	d := test_daemon_start(t)
+	p := test_pool(d.addr)
+	defer p.Close()
+	ctx := context.Background()
+
+	if _, err := p.Status(ctx); err != nil {
+		t.Fatal("status:", err)
+	}
+
+	// The idle connection is lost, STAT is sent again on a new one
+	d.drop()
+	if _, err := p.Status(ctx); err != nil {
+		t.Error("status after drop:", err)
+	}
+	d.board.Set_reg(0x10, 0x33)
+	d.drop()
+	if v, err := p.Read8(ctx, 0x10); err != nil || v != 0x33 {
+		t.Errorf("read8 after drop %02x %v, want 33", v, err)
+	}
+}
+
+func TestPoolNoRetryAfterSend(t *testing.T) {
+	d := test_daemon_start(t)
+	p := test_pool(d.addr)
+	defer p.Close()
+	ctx := context.Background()
+
+	if _, err := p.Status(ctx); err != nil {
+		t.Fatal("status:", err)
+	}
+
+	// WRITE may have been executed, it is not sent again
+	d.drop()
+	if err := p.Write8(ctx, 0x20, 0x01); err == nil {
+		t.Error("write8 after drop succeeded, want connection error")
+	}
+
+	// The broken connection is not reused
+	if err := p.Write8(ctx, 0x20, 0x02); err != nil {
+		t.Fatal("write8:", err)
+	}
+	if v := d.board.Get_reg(0x20); v != 0x02 {
+		t.Errorf("board register %02x, want 02", v)
+	}
+}
+
+func TestPoolRetryDial(t *testing.T) {
+	d := test_daemon_start(t)
+	p := test_pool(d.addr)
+	defer p.Close()
+
+	// Daemon down for a while, the connection is retried before sending
+	d.stop()
+	restart := make(chan error, 1)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		restart <- d.listen(d.addr)
+	}()
+
+	if err := p.Init(context.Background()); err != nil {
+		t.Error("init while restarting:", err)
+	}
+	if err := <-restart; err != nil {
+		t.Fatal("restart:", err)
+	}
+}
@@ -0,0 +1,557 @@
+//-----------------------------------------------------------------------------
+// cmd.go
+// nyacom (C) 2018.05
+// Terminal command execution (shared by text and framed protocol)
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"strings"
+	"encoding/json"
+	"./gpio"	// RPi GPIO lib
+)
+
+//-----------------------------------------------------------------------------
+// Terminal commands
+//-----------------------------------------------------------------------------
+const (
+	TERM_CMD_STAT     = "STAT"
+	TERM_CMD_PROG     = "PROG"
+	TERM_CMD_PROG_PR  = "PROGPR"
+	TERM_CMD_PROG8    = "PROG8"
+	TERM_CMD_PROG8_PR = "PROG8PR"
+	TERM_CMD_START    = "START"
+	TERM_CMD_RESET    = "RESET"
+	TERM_CMD_WRITE    = "WRITE"
+	TERM_CMD_READ     = "READ"
+	TERM_CMD_WRITE16  = "WRITE16"
+	TERM_CMD_WRITE32  = "WRITE32"
+	TERM_CMD_WRITE64  = "WRITE64"
+	TERM_CMD_READ16   = "READ16"
+	TERM_CMD_READ32   = "READ32"
+	TERM_CMD_READ64   = "READ64"
+	TERM_CMD_SETBITS  = "SETBITS"
+	TERM_CMD_CLRBITS  = "CLRBITS"
+	TERM_CMD_RMW      = "RMW"
+	TERM_CMD_WAIT     = "WAIT"
+	TERM_CMD_HELP     = "HELP"
+	TERM_CMD_CAPS     = "CAPS"
+	TERM_CMD_AUTH     = "AUTH"
+	TERM_CMD_RESERVE  = "RESERVE"
+	TERM_CMD_RENEW    = "RENEW"
+	TERM_CMD_RELEASE  = "RELEASE"
+	TERM_CMD_WHO      = "WHO"
+	TERM_CMD_AUDIT    = "AUDIT"
+	TERM_CMD_QUEUE    = "QUEUE"
+	TERM_CMD_INIT     = "INIT"	// FPGA INIT
+)
+
+// Command reference for HELP (command, arguments, description)
+var term_cmd_help = [][3]string{
+	{TERM_CMD_STAT,     "",                                     "Report FiC status (JSON)"},
+	{TERM_CMD_PROG,     "<size> [name]",                        "Program FPGA with SelectMAP x16"},
+	{TERM_CMD_PROG_PR,  "<size> [name]",                        "Partial reconfiguration with SelectMAP x16"},
+	{TERM_CMD_PROG8,    "<size> [name]",                        "Program FPGA with SelectMAP x8"},
+	{TERM_CMD_PROG8_PR, "<size> [name]",                        "Partial reconfiguration with SelectMAP x8"},
+	{TERM_CMD_INIT,     "",                                     "FPGA init (pulse PROG_B)"},
+	{TERM_CMD_RESET,    "",                                     "Reset user module"},
+	{TERM_CMD_START,    "",                                     "Start user module"},
+	{TERM_CMD_READ,     "<addr>",                               "Read 8bit register (hex)"},
+	{TERM_CMD_WRITE,    "<addr> <data>",                        "Write 8bit register (hex)"},
+	{TERM_CMD_READ16,   "<addr> [le|be] [latch]",               "Read 16bit register"},
+	{TERM_CMD_READ32,   "<addr> [le|be] [latch]",               "Read 32bit register"},
+	{TERM_CMD_READ64,   "<addr> [le|be] [latch]",               "Read 64bit register"},
+	{TERM_CMD_WRITE16,  "<addr> <data> [le|be] [latch]",        "Write 16bit register"},
+	{TERM_CMD_WRITE32,  "<addr> <data> [le|be] [latch]",        "Write 32bit register"},
+	{TERM_CMD_WRITE64,  "<addr> <data> [le|be] [latch]",        "Write 64bit register"},
+	{TERM_CMD_SETBITS,  "<addr> <mask>",                        "Set register bits atomically"},
+	{TERM_CMD_CLRBITS,  "<addr> <mask>",                        "Clear register bits atomically"},
+	{TERM_CMD_RMW,      "<addr> <mask> <data>",                 "Read-modify-write register atomically"},
+	{TERM_CMD_WAIT,     "<addr> <mask> <data> <tmo> [intv]",     "Poll register until match (msec)"},
+	{TERM_CMD_HELP,     "",                                     "Show this help"},
+	{TERM_CMD_CAPS,     "",                                     "Report daemon capabilities (JSON)"},
+	{TERM_CMD_AUTH,     "<token>",                              "Authenticate this connection"},
+	{TERM_CMD_RESERVE,  "[sec]",                                "Reserve the board for exclusive use"},
+	{TERM_CMD_RENEW,    "[sec]",                                "Extend own reservation"},
+	{TERM_CMD_RELEASE,  "[force]",                              "Release reservation (force: admin)"},
+	{TERM_CMD_WHO,      "",                                     "Show reservation (JSON)"},
+	{TERM_CMD_AUDIT,    "[n] [key=value ...]",                  "Query audit log (cmd, who, result, since, until)"},
+	{TERM_CMD_QUEUE,    "",                                     "Show hardware operation queue (JSON)"},
+}
+
+// Enabled features (optional servers append at init)
+var daemon_features = []string{"rmw", "wait", "module_ctrl", "framed", "jsonrpc", "auth", "lease", "audit", "queue"}
+
+// Daemon capabilities for CAPS
+type FicCaps struct {
+	Version   string	`json:"version"`	// Daemon version
+	Protocol  int		`json:"protocol"`	// Protocol version
+	ProgModes []string	`json:"prog_modes"`	// Supported programming modes
+	RegWidths []int		`json:"reg_widths"`	// Supported register widths in bit
+	Board     string	`json:"board"`		// Board profile
+	Features  []string	`json:"features"`	// Enabled features
+	Commands  []string	`json:"commands"`	// Supported commands
+}
+
+func monitor_get_caps()(caps FicCaps) {
+	caps.Version   = DAEMON_VERSION
+	caps.Protocol  = PROTOCOL_VERSION
+	caps.ProgModes = []string{"x16", "x16pr", "x8", "x8pr"}
+	caps.RegWidths = []int{8, 16, 32, 64}
+	caps.Board     = BOARD_PROFILE
+	caps.Features  = append([]string{}, daemon_features...)
+	if tls_enabled() {
+		caps.Features = append(caps.Features, "tls")
+	}
+	for _, c := range term_cmd_help {
+		caps.Commands = append(caps.Commands, c[0])
+	}
+	return caps
+}
+
+// Parse optional multi-byte register arguments: [le|be] [latch]
+func monitor_parse_reg_opts(args []string)(endian int, latch bool, err error) {
+	endian = COM_ENDIAN_LITTLE
+	for _, a := range args {
+		switch strings.ToLower(a) {
+		case "le":
+			endian = COM_ENDIAN_LITTLE
+		case "be":
+			endian = COM_ENDIAN_BIG
+		case "latch":
+			latch = true
+		default:
+			return endian, latch, fic_error(ERR_BAD_ARGS, "Unknown register option " + a)
+		}
+	}
+	return endian, latch, nil
+}
+
+// Scheduler priority of hardware commands
+// Note: WAIT is scheduled per poll in fic_wait8
+var cmd_prio = map[string]int {
+	TERM_CMD_READ:     PRIO_INTERACTIVE,
+	TERM_CMD_READ16:   PRIO_INTERACTIVE,
+	TERM_CMD_READ32:   PRIO_INTERACTIVE,
+	TERM_CMD_READ64:   PRIO_INTERACTIVE,
+
+	TERM_CMD_WRITE:    PRIO_NORMAL,
+	TERM_CMD_WRITE16:  PRIO_NORMAL,
+	TERM_CMD_WRITE32:  PRIO_NORMAL,
+	TERM_CMD_WRITE64:  PRIO_NORMAL,
+	TERM_CMD_SETBITS:  PRIO_NORMAL,
+	TERM_CMD_CLRBITS:  PRIO_NORMAL,
+	TERM_CMD_RMW:      PRIO_NORMAL,
+	TERM_CMD_RESET:    PRIO_NORMAL,
+	TERM_CMD_START:    PRIO_NORMAL,
+	TERM_CMD_PROG:     PRIO_NORMAL,
+	TERM_CMD_PROG_PR:  PRIO_NORMAL,
+	TERM_CMD_PROG8:    PRIO_NORMAL,
+	TERM_CMD_PROG8_PR: PRIO_NORMAL,
+	TERM_CMD_INIT:     PRIO_NORMAL,
+}
+
+// FPGA configuration commands (with bitstream data)
+func cmd_is_prog(cmd string) bool {
+	switch cmd {
+	case TERM_CMD_PROG, TERM_CMD_PROG8, TERM_CMD_PROG_PR, TERM_CMD_PROG8_PR:
+		return true
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// Execute one command
+// b is the command line split into fields, data is the payload (PROG only)
+// Returns response body without line terminator (nil for no response)
+//-----------------------------------------------------------------------------
+func monitor_exec(s *Session, b []string, data []byte, mon *FicStat)(resp []byte, err error) {
+	t1 := time.Now()
+	defer func() {
+		audit_record(s, b[0], b[1:], data, t1, err)
+	} ()
+
+	if err := auth_check(s, b[0]); err != nil {
+		return nil, err
+	}
+	if err := lease_check(s, b[0]); err != nil {
+		return nil, err
+	}
+
+	// Hardware operations go through the scheduler
+	prio, hw := cmd_prio[b[0]]
+	if !hw {
+		return monitor_exec_cmd(s, b, data, mon)
+	}
+	err = sched_run(s.Ctx, b[0], s.Who(), prio, s.Queued, func() error {
+		resp, err = monitor_exec_cmd(s, b, data, mon)
+		return err
+	})
+	return resp, err
+}
+
+func monitor_exec_cmd(s *Session, b []string, data []byte, mon *FicStat)(resp []byte, err error) {
+	ctx := s.Ctx
+
+	switch b[0] {
+	// Report status
+	case TERM_CMD_STAT:
+		fmt.Println("DEBUG: STAT")
+
+		jsonbyte, err := json.Marshal(monitor_load(mon))
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+
+	// FPGA Configuration
+	case TERM_CMD_PROG, TERM_CMD_PROG8, TERM_CMD_PROG_PR, TERM_CMD_PROG8_PR:
+		fmt.Println("DEBUG: PROG", len(data))
+		if len(b) < 2 {
+			return nil, fic_error(ERR_BAD_ARGS, "PROG ARG ERROR")
+		}
+		// 2nd argument is data size
+		size, err := strconv.Atoi(b[1])
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "PROG ARG SIZE ERROR")
+		}
+		if size != len(data) {
+			return nil, fic_errorf(ERR_SIZE_MISMATCH, "Received bitstream size mismatch %d", size - len(data))
+		}
+
+		// 3rd argument is file name (optional)
+		var name string
+		if len(b) > 2 {
+			name = b[2]
+		}
+
+		// Send to FPGA (.bit or .bin)
+		switch b[0] {
+		case TERM_CMD_PROG, TERM_CMD_PROG_PR:
+			err = prog_record(ctx, s.Who(), name, data, 16, b[0] == TERM_CMD_PROG_PR)
+		case TERM_CMD_PROG8, TERM_CMD_PROG8_PR:
+			err = prog_record(ctx, s.Who(), name, data, 8, b[0] == TERM_CMD_PROG8_PR)
+		}
+		monitor_refresh(ctx, mon)	// Also on failure, DONE and partitions change
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("DEBUG: PROG DONE")
+		return nil, nil
+
+	// Register Write
+	case TERM_CMD_WRITE:
+		fmt.Println("DEBUG: WRITE")
+		if len(b) < 3 {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG ERROR")
+		}
+		// 2nd argument is write 1b address
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG ADDR ERROR")
+		}
+		// 3rd argument is write data (1byte)
+		data, err := strconv.ParseUint(b[2], 16, 8)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG DATA ERROR")
+		}
+
+		if err := fic_lock(ctx); err != nil {
+			return nil, err
+		}
+		err = fic_write8(ctx, uint16(addr), uint8(data))
+		gpio.Gpio_unlock()
+		return nil, err
+
+	// Register Read
+	case TERM_CMD_READ:
+		fmt.Println("DEBUG: READ")
+		if len(b) < 2 {
+			return nil, fic_error(ERR_BAD_ARGS, "READ ARG ERROR")
+		}
+		// 2nd argument is read address
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "READ ARG ADDR ERROR")
+		}
+
+		if err := fic_lock(ctx); err != nil {
+			return nil, err
+		}
+		data, err := fic_read8(ctx, uint16(addr))
+		gpio.Gpio_unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(strconv.FormatInt(int64(data), 16)), nil
+
+	// Multi-byte register Write
+	case TERM_CMD_WRITE16, TERM_CMD_WRITE32, TERM_CMD_WRITE64:
+		fmt.Println("DEBUG:", b[0])
+		if len(b) < 3 {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG ERROR")
+		}
+		width := map[string]int{TERM_CMD_WRITE16: 2, TERM_CMD_WRITE32: 4, TERM_CMD_WRITE64: 8}[b[0]]
+
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG ADDR ERROR")
+		}
+		data, err := strconv.ParseUint(b[2], 16, width*8)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WRITE ARG DATA ERROR")
+		}
+		endian, latch, err := monitor_parse_reg_opts(b[3:])
+		if err != nil {
+			return nil, err
+		}
+
+		// Hold the lock for the whole word
+		if err := fic_lock(ctx); err != nil {
+			return nil, err
+		}
+		err = fic_write_n(ctx, uint16(addr), width, data, endian, latch)
+		gpio.Gpio_unlock()
+		return nil, err
+
+	// Multi-byte register Read
+	case TERM_CMD_READ16, TERM_CMD_READ32, TERM_CMD_READ64:
+		fmt.Println("DEBUG:", b[0])
+		if len(b) < 2 {
+			return nil, fic_error(ERR_BAD_ARGS, "READ ARG ERROR")
+		}
+		width := map[string]int{TERM_CMD_READ16: 2, TERM_CMD_READ32: 4, TERM_CMD_READ64: 8}[b[0]]
+
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "READ ARG ADDR ERROR")
+		}
+		endian, latch, err := monitor_parse_reg_opts(b[2:])
+		if err != nil {
+			return nil, err
+		}
+
+		// Hold the lock for the whole word
+		if err := fic_lock(ctx); err != nil {
+			return nil, err
+		}
+		data, err := fic_read_n(ctx, uint16(addr), width, endian, latch)
+		gpio.Gpio_unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(strconv.FormatUint(data, 16)), nil
+
+	// Register bit set / clear / read-modify-write
+	case TERM_CMD_SETBITS, TERM_CMD_CLRBITS, TERM_CMD_RMW:
+		fmt.Println("DEBUG:", b[0])
+		nargs := 3
+		if b[0] == TERM_CMD_RMW {
+			nargs = 4
+		}
+		if len(b) < nargs {
+			return nil, fic_error(ERR_BAD_ARGS, b[0] + " ARG ERROR")
+		}
+		// 2nd argument is address
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, b[0] + " ARG ADDR ERROR")
+		}
+		// 3rd argument is bit mask (1byte)
+		mask, err := strconv.ParseUint(b[2], 16, 8)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, b[0] + " ARG MASK ERROR")
+		}
+		// 4th argument is value under mask (RMW only)
+		var data uint64
+		switch b[0] {
+		case TERM_CMD_SETBITS:
+			data = 0xff
+		case TERM_CMD_RMW:
+			data, err = strconv.ParseUint(b[3], 16, 8)
+			if err != nil {
+				return nil, fic_error(ERR_BAD_ARGS, b[0] + " ARG DATA ERROR")
+			}
+		}
+
+		// Hold the lock for read and write back
+		if err := fic_lock(ctx); err != nil {
+			return nil, err
+		}
+		res, err := fic_rmw8(ctx, uint16(addr), uint8(mask), uint8(data))
+		gpio.Gpio_unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		// send back written value
+		return []byte(strconv.FormatInt(int64(res), 16)), nil
+
+	// Poll register until condition met
+	// WAIT <addr> <mask> <value> <timeout msec> [interval msec]
+	case TERM_CMD_WAIT:
+		fmt.Println("DEBUG: WAIT")
+		if len(b) < 5 {
+			return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG ERROR")
+		}
+		addr, err := strconv.ParseUint(b[1], 16, 16)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG ADDR ERROR")
+		}
+		mask, err := strconv.ParseUint(b[2], 16, 8)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG MASK ERROR")
+		}
+		data, err := strconv.ParseUint(b[3], 16, 8)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG DATA ERROR")
+		}
+		timeout, err := strconv.ParseUint(b[4], 10, 32)
+		if err != nil {
+			return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG TIMEOUT ERROR")
+		}
+		interval := uint64(WAIT_POLL_PERIOD)
+		if len(b) > 5 {
+			interval, err = strconv.ParseUint(b[5], 10, 32)
+			if err != nil || interval == 0 {
+				return nil, fic_error(ERR_BAD_ARGS, "WAIT ARG INTERVAL ERROR")
+			}
+		}
+
+		res, elapsed, err := fic_wait8(s.Ctx, s.Who(), uint16(addr), uint8(mask), uint8(data),
+			time.Duration(timeout) * time.Millisecond,
+			time.Duration(interval) * time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+
+		// send back final value and elapsed time in msec
+		return []byte(strconv.FormatInt(int64(res), 16) + " " +
+			strconv.FormatInt(elapsed.Nanoseconds() / int64(time.Millisecond), 10)), nil
+
+	// User module reset
+	case TERM_CMD_RESET:
+		fmt.Println("DEBUG: RESET")
+		return nil, fic_module_reset(ctx)
+
+	// User module start
+	case TERM_CMD_START:
+		fmt.Println("DEBUG: START")
+		return nil, fic_module_start(ctx)
+
+	// FPGA reset
+	case TERM_CMD_INIT:
+		fmt.Println("DEBUG: INIT")
+		if err := fic_fpga_init(ctx); err != nil {
+			return nil, err
+		}
+		monitor_refresh(ctx, mon)
+		return nil, nil
+
+	// Command reference
+	case TERM_CMD_HELP:
+		fmt.Println("DEBUG: HELP")
+		lines := []string{}
+		for _, c := range term_cmd_help {
+			lines = append(lines, fmt.Sprintf("%-8s %-40s %s", c[0], c[1], c[2]))
+		}
+		return []byte(strings.Join(lines, "\r\n")), nil
+
+	// Authentication
+	case TERM_CMD_AUTH:
+		fmt.Println("DEBUG: AUTH")
+		if len(b) < 2 {
+			return nil, fic_error(ERR_BAD_ARGS, "AUTH ARG ERROR")
+		}
+		if err := auth_login(s, b[1]); err != nil {
+			return nil, err
+		}
+		return []byte(s.Who() + " " + role_name(s.Role)), nil
+
+	// Board reservation
+	case TERM_CMD_RESERVE, TERM_CMD_RENEW:
+		fmt.Println("DEBUG:", b[0])
+		sec := 0
+		if len(b) > 1 {
+			sec, err = strconv.Atoi(b[1])
+			if err != nil {
+				return nil, fic_error(ERR_BAD_ARGS, b[0] + " ARG ERROR")
+			}
+		}
+		var l Lease
+		if b[0] == TERM_CMD_RESERVE {
+			l, err = lease_reserve(s, sec)
+		} else {
+			l, err = lease_renew(s, sec)
+		}
+		if err != nil {
+			return nil, err
+		}
+		jsonbyte, err := json.Marshal(l)
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+
+	case TERM_CMD_RELEASE:
+		fmt.Println("DEBUG: RELEASE")
+		return nil, lease_release(s, len(b) > 1 && b[1] == "force")
+
+	case TERM_CMD_WHO:
+		fmt.Println("DEBUG: WHO")
+		jsonbyte, err := json.Marshal(lease_who())
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+
+	// Audit log query
+	case TERM_CMD_AUDIT:
+		fmt.Println("DEBUG: AUDIT")
+		n := AUDIT_QUERY_COUNT
+		filters := b[1:]
+		if len(filters) > 0 && !strings.Contains(filters[0], "=") {
+			n, err = strconv.Atoi(filters[0])
+			if err != nil {
+				return nil, fic_error(ERR_BAD_ARGS, "AUDIT ARG ERROR")
+			}
+			filters = filters[1:]
+		}
+		entries, err := audit_query(n, filters)
+		if err != nil {
+			return nil, err
+		}
+		jsonbyte, err := json.Marshal(entries)
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+
+	// Hardware operation queue
+	case TERM_CMD_QUEUE:
+		fmt.Println("DEBUG: QUEUE")
+		jsonbyte, err := json.Marshal(sched_stat())
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+
+	// Capability discovery
+	case TERM_CMD_CAPS:
+		fmt.Println("DEBUG: CAPS")
+		jsonbyte, err := json.Marshal(monitor_get_caps())
+		if err != nil {
+			return nil, fic_error(ERR_JSON, err.Error())
+		}
+		return jsonbyte, nil
+	}
+
+	// Unknown command
+	return nil, fic_error(ERR_UNKNOWN_CMD, "Unknown command " + b[0])
+}
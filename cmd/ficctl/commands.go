@@ -0,0 +1,656 @@
+//-----------------------------------------------------------------------------
+// commands.go
+// nyacom (C) 2018.05
+// ficctl subcommands
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"sort"
+	"bytes"
+	"strconv"
+	"strings"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"text/tabwriter"
+	"encoding/json"
+	"../../client"
+	"../../fleet"
+	"../../selectmap"
+)
+
+// Subcommand usage is printed by "ficctl" without arguments
+func usage_error(name string, msg string) int {
+	fmt.Fprintln(os.Stderr, "Error: " + name + ":", msg)
+	return EXIT_USAGE
+}
+
+func parse_addr(s string)(uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 16)
+	return uint16(v), err
+}
+
+func hex8(v uint8) string {
+	return fmt.Sprintf("%02x", v)
+}
+
+//-----------------------------------------------------------------------------
+// status, watch
+//-----------------------------------------------------------------------------
+var status_header = []string{"DONE", "PWR", "STATE", "HLS", "LINKUP", "CHUP", "DIPSW", "LED", "TS", "BITSTREAM"}
+
+// Design name of .bit header, file name or hash, and the unchecked partial
+func bitstream_name(b *client.Bitstream) string {
+	switch {
+	case b == nil:
+		return "-"
+	case b.Partial != nil:
+		return bitstream_name(&client.Bitstream{Sha256: b.Sha256, Name: b.Name, Bit: b.Bit}) + " +" + bitstream_name(b.Partial)
+	case b.Bit != nil && b.Bit.Design != "":
+		return b.Bit.Design
+	case b.Name != "":
+		return b.Name
+	}
+	return short_sha(b.Sha256)
+}
+
+func status_rows(v interface{})([][]string) {
+	st := v.(*client.Status)
+	return [][]string{{
+		strconv.Itoa(int(st.Done)), strconv.Itoa(int(st.Pwr)),
+		hex8(st.State), hex8(st.Hls), hex8(st.Linkup), hex8(st.Chup), hex8(st.Dipsw), hex8(st.Led),
+		st.Ts.Format("15:04:05"), bitstream_name(st.Bitstream),
+	}}
+}
+
+func cmd_status(ctx context.Context, ctl *Ctl, args []string) int {
+	return ctl.print(ctl.Fleet.Status(ctx), status_header, status_rows)
+}
+
+func cmd_watch(ctx context.Context, ctl *Ctl, args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("i", 5 * time.Second, "Interval")
+	count := fs.Int("n", 0, "Number of rounds (0: until interrupted)")
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+
+	code := EXIT_OK
+	for n := 0; *count == 0 || n < *count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return code
+			case <-time.After(*interval):
+			}
+		}
+		code = ctl.print(ctl.Fleet.Status(ctx), status_header, status_rows)
+		if !ctl.Json {
+			fmt.Println("")
+		}
+	}
+	return code
+}
+
+//-----------------------------------------------------------------------------
+// read, write, dump
+//-----------------------------------------------------------------------------
+type RegOpts struct {
+	Width int
+	Be    bool
+	Latch bool
+}
+
+func reg_flags(name string, o *RegOpts)(*flag.FlagSet) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.IntVar(&o.Width, "w", 8, "Register width {8, 16, 32, 64}")
+	fs.BoolVar(&o.Be, "be", false, "Big endian (wide registers)")
+	fs.BoolVar(&o.Latch, "latch", false, "Atomic latch convention (wide registers)")
+	return fs
+}
+
+func (o RegOpts) opts()([]string) {
+	opts := []string{}
+	if o.Be {
+		opts = append(opts, client.REG_BE)
+	}
+	if o.Latch {
+		opts = append(opts, client.REG_LATCH)
+	}
+	return opts
+}
+
+func cmd_read(ctx context.Context, ctl *Ctl, args []string) int {
+	var o RegOpts
+	fs := reg_flags("read", &o)
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+	if fs.NArg() != 1 {
+		return usage_error("read", "ADDR required")
+	}
+	addr, err := parse_addr(fs.Arg(0))
+	if err != nil {
+		return usage_error("read", "Invalid ADDR " + fs.Arg(0))
+	}
+
+	res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+		v, err := c.ReadNContext(ctx, addr, o.Width, o.opts()...)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("%0*x", o.Width / 4, v), nil
+	})
+	return ctl.print(res, []string{"ADDR", "VALUE"}, func(v interface{})([][]string) {
+		return [][]string{{fmt.Sprintf("%04x", addr), v.(string)}}
+	})
+}
+
+func cmd_write(ctx context.Context, ctl *Ctl, args []string) int {
+	var o RegOpts
+	fs := reg_flags("write", &o)
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+	if fs.NArg() != 2 {
+		return usage_error("write", "ADDR and VALUE required")
+	}
+	addr, err := parse_addr(fs.Arg(0))
+	if err != nil {
+		return usage_error("write", "Invalid ADDR " + fs.Arg(0))
+	}
+	data, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fs.Arg(1)), "0x"), 16, o.Width)
+	if err != nil {
+		return usage_error("write", "Invalid VALUE " + fs.Arg(1))
+	}
+
+	res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+		return "ok", c.WriteNContext(ctx, addr, o.Width, data, o.opts()...)
+	})
+	return ctl.print(res, []string{"RESULT"}, rows_ok)
+}
+
+// Registers read by dump (hex string per byte)
+type Dump struct {
+	Addr uint16	`json:"addr"`
+	Data []string	`json:"data"`
+}
+
+func cmd_dump(ctx context.Context, ctl *Ctl, args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		return usage_error("dump", "ADDR required")
+	}
+	addr, err := parse_addr(args[0])
+	if err != nil {
+		return usage_error("dump", "Invalid ADDR " + args[0])
+	}
+	n := 16
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 || int(addr) + n - 1 > 0xffff {
+			return usage_error("dump", "Invalid LEN " + args[1])
+		}
+	}
+
+	res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+		d := Dump{Addr: addr}
+		for i := 0; i < n; i++ {
+			v, err := c.Read8Context(ctx, addr + uint16(i))
+			if err != nil {
+				return nil, err
+			}
+			d.Data = append(d.Data, hex8(v))
+		}
+		return d, nil
+	})
+	return ctl.print(res, []string{"ADDR", "DATA"}, func(v interface{})([][]string) {
+		d := v.(Dump)
+		rows := [][]string{}
+		for i := 0; i < len(d.Data); i += 16 {
+			end := i + 16
+			if end > len(d.Data) {
+				end = len(d.Data)
+			}
+			rows = append(rows, []string{fmt.Sprintf("%04x", int(d.Addr) + i), strings.Join(d.Data[i:end], " ")})
+		}
+		return rows
+	})
+}
+
+//-----------------------------------------------------------------------------
+// prog, init, reset, start
+//-----------------------------------------------------------------------------
+type ProgResult struct {
+	Size    int	`json:"size"`
+	Elapsed float64	`json:"elapsed"`	// sec
+	Done    *uint8	`json:"done,omitempty"`	// DONE after programming (-verify)
+}
+
+func cmd_prog(ctx context.Context, ctl *Ctl, args []string) int {
+	fs := flag.NewFlagSet("prog", flag.ContinueOnError)
+	mode := fs.Int("m", 16, "Selectmap mode {8, 16}")
+	pr := fs.Bool("c", false, "No-reset mode for PR")
+	verify := fs.Bool("verify", false, "Check sync word before and DONE after programming")
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+	if fs.NArg() != 1 {
+		return usage_error("prog", "FILE required")
+	}
+	if *mode != 8 && *mode != 16 {
+		return usage_error("prog", "Invalid mode")
+	}
+
+	// The file is sent as is, the daemon records the .bit header
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return EXIT_ERROR
+	}
+	bin := data
+	if selectmap.Is_bit(data) {
+		if bin, _, err = selectmap.Parse_bit(data); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", fs.Arg(0), err)
+			return EXIT_ERROR
+		}
+	}
+	if *verify {
+		if err := selectmap.Check(bin, *mode); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return EXIT_ERROR
+		}
+	}
+
+	res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+		t1 := time.Now()
+		if err := c.ProgramNamedContext(ctx, bytes.NewReader(data), client.Mode(*mode), *pr, filepath.Base(fs.Arg(0))); err != nil {
+			return nil, err
+		}
+		r := ProgResult{Size: len(bin), Elapsed: time.Now().Sub(t1).Seconds()}
+
+		if *verify && !*pr {
+			st, err := c.StatusContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			r.Done = &st.Done
+			if st.Done != 1 {
+				return r, fmt.Errorf("verify failed (DONE %d)", st.Done)
+			}
+		}
+		return r, nil
+	})
+	return ctl.print(res, []string{"SIZE", "ELAPSED"}, func(v interface{})([][]string) {
+		r := v.(ProgResult)
+		return [][]string{{strconv.Itoa(r.Size), fmt.Sprintf("%.2fs", r.Elapsed)}}
+	})
+}
+
+// Command without arguments and response
+func cmd_simple(cmd string) func(context.Context, *Ctl, []string) int {
+	return func(ctx context.Context, ctl *Ctl, args []string) int {
+		res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+			_, err := c.DoContext(ctx, cmd, nil)
+			return "ok", err
+		})
+		return ctl.print(res, []string{"RESULT"}, rows_ok)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// reserve
+//-----------------------------------------------------------------------------
+func lease_rows(v interface{})([][]string) {
+	l, _ := v.(*client.Lease)
+	if l == nil {
+		return [][]string{{"-", "", ""}}
+	}
+	return [][]string{{l.Owner, l.Since.Format(time.RFC3339), l.Expire.Format(time.RFC3339)}}
+}
+
+func cmd_reserve(ctx context.Context, ctl *Ctl, args []string) int {
+	action := "reserve"
+	if len(args) > 0 {
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			action, args = args[0], args[1:]
+		}
+	}
+
+	sec := 0
+	if (action == "reserve" || action == "renew") && len(args) > 0 {
+		var err error
+		if sec, err = strconv.Atoi(args[0]); err != nil {
+			return usage_error("reserve", "Invalid SEC " + args[0])
+		}
+	}
+
+	var fn BoardFunc
+	switch action {
+	case "reserve":
+		fn = func(ctx context.Context, c *client.Client)(interface{}, error) {
+			return c.ReserveContext(ctx, sec)
+		}
+	case "renew":
+		fn = func(ctx context.Context, c *client.Client)(interface{}, error) {
+			return c.RenewContext(ctx, sec)
+		}
+	case "who":
+		fn = func(ctx context.Context, c *client.Client)(interface{}, error) {
+			return c.WhoContext(ctx)
+		}
+	case "release":
+		force := len(args) > 0 && args[0] == "force"
+		res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+			return "ok", c.ReleaseContext(ctx, force)
+		})
+		return ctl.print(res, []string{"RESULT"}, rows_ok)
+	default:
+		return usage_error("reserve", "Unknown action " + action)
+	}
+
+	return ctl.print(ctl.each(ctx, fn), []string{"OWNER", "SINCE", "EXPIRE"}, lease_rows)
+}
+
+//-----------------------------------------------------------------------------
+// logs
+//-----------------------------------------------------------------------------
+func cmd_logs(ctx context.Context, ctl *Ctl, args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	n := fs.Int("n", 20, "Number of entries")
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+
+	res := ctl.each(ctx, func(ctx context.Context, c *client.Client)(interface{}, error) {
+		return c.AuditContext(ctx, *n, fs.Args()...)
+	})
+	return ctl.print(res, []string{"TIME", "WHO", "PROTO", "CMD", "RESULT", "DURATION", "ARGS"}, func(v interface{})([][]string) {
+		rows := [][]string{}
+		for _, e := range v.([]client.AuditEntry) {
+			who := e.Identity
+			if who == "" {
+				who = e.Addr
+			}
+			args, _ := json.Marshal(e.Args)
+			rows = append(rows, []string{
+				e.Ts.Format(time.RFC3339), who, e.Proto, e.Cmd, e.Result,
+				fmt.Sprintf("%.3fs", e.Duration), string(args),
+			})
+		}
+		return rows
+	})
+}
+
+//-----------------------------------------------------------------------------
+// health, boards
+//-----------------------------------------------------------------------------
+func cmd_health(ctx context.Context, ctl *Ctl, args []string) int {
+	h := fleet.Summarize(ctl.Fleet.Status(ctx))
+
+	code := EXIT_OK
+	if !h.Ok {
+		code = EXIT_UNHEALTHY
+	}
+
+	if ctl.Json {
+		jsonbyte, _ := json.MarshalIndent(h, "", "  ")
+		fmt.Println(string(jsonbyte))
+		return code
+	}
+
+	state := "ok"
+	if !h.Ok {
+		state = "NOT OK"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "HEALTH\t%s\n", state)
+	fmt.Fprintf(w, "REACHABLE\t%d / %d\t%s\n", h.Reachable, h.Boards, strings.Join(h.Unreachable, " "))
+	fmt.Fprintf(w, "POWER OK\t%d / %d\t%s\n", h.PowerOk, h.Reachable, strings.Join(h.PowerFail, " "))
+	fmt.Fprintf(w, "DONE\t%d / %d\t%s\n", h.Done, h.Reachable, strings.Join(h.NotDone, " "))
+	fmt.Fprintf(w, "STALE\t%d\t%s\n", len(h.Stale), strings.Join(h.Stale, " "))
+	fmt.Fprintf(w, "LINKS UP\t%d / %d\n", h.LinksUp, 8 * h.Reachable)
+	fmt.Fprintf(w, "CHANNELS UP\t%d / %d\n", h.ChannelsUp, 8 * h.Reachable)
+	w.Flush()
+
+	return code
+}
+
+func cmd_boards(ctx context.Context, ctl *Ctl, args []string) int {
+	if ctl.Json {
+		jsonbyte, _ := json.MarshalIndent(ctl.Fleet.Boards, "", "  ")
+		fmt.Println(string(jsonbyte))
+		return EXIT_OK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BOARD\tADDR\tTAGS")
+	for _, b := range ctl.Fleet.Boards {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", b.Name, b.Addr, strings.Join(b.Tags, ","))
+	}
+	w.Flush()
+
+	return EXIT_OK
+}
+
+//-----------------------------------------------------------------------------
+// topo
+//-----------------------------------------------------------------------------
+func on_off(v bool) string {
+	if v {
+		return "up"
+	}
+	return "down"
+}
+
+func cmd_topo(ctx context.Context, ctl *Ctl, args []string) int {
+	fs := flag.NewFlagSet("topo", flag.ContinueOnError)
+	path := fs.String("t", os.Getenv("FIC_TOPOLOGY"), "Topology descriptor (default $FIC_TOPOLOGY)")
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+
+	// Port state only
+	if *path == "" {
+		return ctl.print(ctl.Fleet.Status(ctx), []string{"PORT", "LINK", "CHUP", "SINCE", "CHANGES", "FLAPPING"}, func(v interface{})([][]string) {
+			st := v.(*client.Status)
+			rows := [][]string{}
+			for i := 0; i < fleet.PORTS; i++ {
+				p := st.Port(i)
+				since := "-"
+				if !p.Since.IsZero() {
+					since = p.Since.Format(time.RFC3339)
+				}
+				rows = append(rows, []string{strconv.Itoa(i), on_off(p.Link), on_off(p.Chup), since, strconv.Itoa(p.Changes), strconv.FormatBool(p.Flapping)})
+			}
+			return rows
+		})
+	}
+
+	topo, err := fleet.Load_topology(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return EXIT_ERROR
+	}
+	reports := topo.Check(ctl.Fleet.Status(ctx))
+
+	code := EXIT_OK
+	for _, r := range reports {
+		if !r.Ok() {
+			code = EXIT_UNHEALTHY
+		}
+	}
+
+	if ctl.Json {
+		jsonbyte, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(jsonbyte))
+		return code
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "A\tB\tSTATE\tMSG")
+	for _, r := range reports {
+		b := "-"
+		if r.B != nil {
+			b = r.B.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.A, b, r.State, r.Msg)
+	}
+	w.Flush()
+
+	return code
+}
+
+//-----------------------------------------------------------------------------
+// pr
+//-----------------------------------------------------------------------------
+// Module in each partition of the loaded PR base
+func pr_rows(v interface{})([][]string) {
+	st := v.(*client.Status)
+	b := st.Bitstream
+	if b == nil || b.Base == "" {
+		return [][]string{{"-", "-", "-", "-", "-"}}
+	}
+
+	var names []string
+	for name := range b.Partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := [][]string{}
+	for _, name := range names {
+		m := b.Partitions[name]
+		if m == nil {
+			rows = append(rows, []string{b.Base, name, "?", "-", "-"})
+			continue
+		}
+		rows = append(rows, []string{b.Base, name, m.Module, short_sha(m.Sha256), m.Programmed.Format(time.RFC3339)})
+	}
+	return rows
+}
+
+func cmd_pr(ctx context.Context, ctl *Ctl, args []string) int {
+	return ctl.print(ctl.Fleet.Status(ctx), []string{"BASE", "PARTITION", "MODULE", "SHA256", "PROGRAMMED"}, pr_rows)
+}
+
+//-----------------------------------------------------------------------------
+// deploy
+//-----------------------------------------------------------------------------
+func default_store() string {
+	if d := os.Getenv("FIC_DEPLOY_STORE"); d != "" {
+		return d
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ficdeploy"
+	}
+	return filepath.Join(home, ".ficdeploy")
+}
+
+func short_sha(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
+
+func cmd_deploy(ctx context.Context, ctl *Ctl, args []string) int {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	mode := fs.Int("m", 0, "Selectmap mode {8, 16} (default plan mode or 16)")
+	topo_path := fs.String("t", os.Getenv("FIC_TOPOLOGY"), "Topology, links among the boards must come up (default $FIC_TOPOLOGY)")
+	store := fs.String("store", default_store(), "Known-good images (default $FIC_DEPLOY_STORE or ~/.ficdeploy)")
+	timeout := fs.Duration("timeout", fleet.DEPLOY_TIMEOUT * time.Second, "Wait for DONE and links")
+	version := fs.String("version", "", "Version of the images (overrides plan)")
+	force := fs.Bool("force", false, "Deploy even if a board does not run its known-good image (no rollback target)")
+	if fs.Parse(args) != nil {
+		return EXIT_USAGE
+	}
+	if fs.NArg() != 1 {
+		return usage_error("deploy", "PLAN.json or FILE required")
+	}
+	if *mode != 0 && *mode != 8 && *mode != 16 {
+		return usage_error("deploy", "Invalid mode")
+	}
+
+	// Plan file, or one image for all boards
+	plan := &fleet.Plan{Default: fs.Arg(0)}
+	if filepath.Ext(fs.Arg(0)) == ".json" {
+		var err error
+		if plan, err = fleet.Load_plan(fs.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return EXIT_ERROR
+		}
+	}
+	if *mode != 0 {
+		plan.Mode = *mode
+	}
+	if *version != "" {
+		plan.Version = *version
+	}
+
+	opts := fleet.DeployOptions{
+		Store: &fleet.Store{Dir: *store},
+		Timeout: *timeout,
+		Force: *force,
+		Log: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format + "\n", args...)
+		},
+	}
+	if *topo_path != "" {
+		var err error
+		if opts.Topology, err = fleet.Load_topology(*topo_path); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return EXIT_ERROR
+		}
+	}
+
+	t := ctl.Fleet.Deploy(ctx, plan, opts)
+
+	code := EXIT_OK
+	switch t.State {
+	case fleet.DEPLOY_ABORTED:
+		code = EXIT_ERROR
+	case fleet.DEPLOY_ROLLED_BACK:
+		code = EXIT_ROLLED_BACK
+	case fleet.DEPLOY_ROLLBACK_FAILED:
+		code = EXIT_ROLLBACK_FAILED
+	}
+
+	if ctl.Json {
+		jsonbyte, _ := json.MarshalIndent(t, "", "  ")
+		fmt.Println(string(jsonbyte))
+		return code
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BOARD\tSHA256\tSTAGE\tERROR\tROLLBACK")
+	for _, d := range t.Boards {
+		sha, rb := "-", "-"
+		if d.Image != nil {
+			sha = short_sha(d.Image.Sha256)
+		}
+		if d.Rollback != nil {
+			rb = "ok " + short_sha(d.Rollback.Sha256)
+			if d.Rollback.Error != "" {
+				rb = "ERROR " + d.Rollback.Error
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Board, sha, d.Stage, d.Error, rb)
+	}
+	for _, l := range t.Links {
+		if !l.Ok() {
+			fmt.Fprintf(w, "LINK %s\t%s\t%s\t%s\t\n", l.A, l.B, l.State, l.Msg)
+		}
+	}
+	w.Flush()
+	fmt.Printf("DEPLOY %s %s %s (%.1fs)\n", t.Id, t.Version, strings.ToUpper(t.State), t.Elapsed)
+	if t.Error != "" {
+		fmt.Println("ERROR", t.Error)
+	}
+
+	return code
+}
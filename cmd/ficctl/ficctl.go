@@ -0,0 +1,299 @@
+//-----------------------------------------------------------------------------
+// ficctl.go
+// nyacom (C) 2018.05
+// Command line client for ficdaemon
+//
+// Usage: ficctl [options] <command> [args]
+// Commands run on every board given by -b, or selected by -s from the
+// inventory file -i (see fleet/inventory.go), in parallel. Results are
+// printed in board order as a table or as JSON (-o json).
+//
+// Exit code
+//  0          Success on all boards
+//  1          Local error
+//  2          Usage error
+//  3          Connection error
+//  4          Cluster is not healthy (health), link mismatch (topo)
+//  5          Deploy failed and was rolled back (deploy)
+//  6          Deploy failed and rollback failed (deploy)
+//  16 + num   Daemon error (num is the numeric error code of the daemon)
+// With several boards the code of the first failed board is returned.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"flag"
+	"time"
+	"strings"
+	"context"
+	"os/signal"
+	"syscall"
+	"io/ioutil"
+	"crypto/tls"
+	"crypto/x509"
+	"text/tabwriter"
+	"encoding/json"
+	"../../client"
+	"../../fleet"
+)
+
+const (
+	EXIT_OK              = 0
+	EXIT_ERROR           = 1
+	EXIT_USAGE           = 2
+	EXIT_CONNECT         = 3
+	EXIT_UNHEALTHY       = 4
+	EXIT_ROLLED_BACK     = 5
+	EXIT_ROLLBACK_FAILED = 6
+	EXIT_DAEMON          = 16
+)
+
+//-----------------------------------------------------------------------------
+func exit_code(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	if e, ok := err.(*client.Error); ok {
+		return EXIT_DAEMON + int(e.Num)
+	}
+	if _, ok := err.(net.Error); ok {
+		return EXIT_CONNECT
+	}
+	if _, ok := err.(*net.OpError); ok {
+		return EXIT_CONNECT
+	}
+	return EXIT_ERROR
+}
+
+//-----------------------------------------------------------------------------
+type Ctl struct {
+	Fleet *fleet.Fleet
+	Json  bool
+}
+
+type BoardFunc func(ctx context.Context, c *client.Client)(interface{}, error)
+
+// Run fn on each board in parallel
+func (ctl *Ctl) each(ctx context.Context, fn BoardFunc)([]fleet.Result) {
+	return ctl.Fleet.Each(ctx, func(ctx context.Context, b fleet.Board, c *client.Client)(interface{}, error) {
+		return fn(ctx, c)
+	})
+}
+
+// Table rows of a successful result
+type RowFunc func(v interface{})([][]string)
+
+// Print results, returns exit code
+func (ctl *Ctl) print(res []fleet.Result, header []string, rows RowFunc) int {
+	code := EXIT_OK
+	for _, r := range res {
+		if r.Err != nil {
+			code = exit_code(r.Err)
+			break
+		}
+	}
+
+	if ctl.Json {
+		jsonbyte, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(jsonbyte))
+		return code
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(append([]string{"BOARD"}, header...), "\t"))
+	for _, r := range res {
+		if r.Err != nil {
+			msg := r.Error
+			if r.Code != "" {
+				msg = r.Code + ": " + msg
+			}
+			fmt.Fprintf(w, "%s\tERROR %s\n", r.Board, msg)
+			continue
+		}
+		for _, row := range rows(r.Value) {
+			fmt.Fprintln(w, strings.Join(append([]string{r.Board}, row...), "\t"))
+		}
+	}
+	w.Flush()
+
+	return code
+}
+
+// Single "ok" column
+func rows_ok(v interface{})([][]string) {
+	return [][]string{{"ok"}}
+}
+
+//-----------------------------------------------------------------------------
+// Commands
+//-----------------------------------------------------------------------------
+type Command struct {
+	Args string
+	Help string
+	Run  func(ctx context.Context, ctl *Ctl, args []string) int
+}
+
+var commands = map[string]Command {
+	"status":  {"",                                  "Board status",                          cmd_status},
+	"watch":   {"[-i interval] [-n count]",          "Repeat status",                         cmd_watch},
+	"read":    {"[-w 8|16|32|64] [-be] [-latch] ADDR", "Read register (hex)",                 cmd_read},
+	"write":   {"[-w 8|16|32|64] [-be] [-latch] ADDR VALUE", "Write register (hex)",          cmd_write},
+	"dump":    {"ADDR [LEN]",                        "Dump 8bit registers (hex, LEN default 16)", cmd_dump},
+	"prog":    {"[-m 8|16] [-c] [-verify] FILE",     "Program FPGA with .bit or .bin",        cmd_prog},
+	"init":    {"",                                  "FPGA init (pulse PROG_B)",              cmd_simple("INIT")},
+	"reset":   {"",                                  "Reset user module",                     cmd_simple("RESET")},
+	"start":   {"",                                  "Start user module",                     cmd_simple("START")},
+	"reserve": {"[SEC] | renew [SEC] | release [force] | who", "Board reservation",           cmd_reserve},
+	"logs":    {"[-n count] [key=value ...]",        "Audit log (cmd, who, result, since, until)", cmd_logs},
+	"health":  {"",                                  "Cluster health summary",                cmd_health},
+	"topo":    {"[-t topology.json]",                "Port link state, checked against the topology", cmd_topo},
+	"pr":      {"",                                  "Modules in the partitions of the PR base", cmd_pr},
+	"deploy":  {"[-m 8|16] [-t TOPO] [-force] PLAN.json|FILE", "Program boards as one transaction with rollback", cmd_deploy},
+	"boards":  {"",                                  "List target boards",                    cmd_boards},
+}
+
+var command_order = []string{"status", "watch", "read", "write", "dump", "prog", "init", "reset", "start", "reserve", "logs", "health", "topo", "pr", "deploy", "boards"}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: ficctl [options] <command> [args]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range command_order {
+		c := commands[name]
+		fmt.Fprintf(os.Stderr, "  %-8s %-44s %s\n", name, c.Args, c.Help)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fs.PrintDefaults()
+}
+
+//-----------------------------------------------------------------------------
+// main
+//-----------------------------------------------------------------------------
+func tls_client_config(enable bool, ca string)(*tls.Config, error) {
+	if !enable && ca == "" {
+		return nil, nil
+	}
+	conf := &tls.Config{}
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", ca)
+		}
+	}
+	return conf, nil
+}
+
+func main() {
+	var (
+		ctl    Ctl
+		opts   client.Options
+		boards string
+		invf   string
+		sel    string
+		par    int
+		output string
+		useTls bool
+		tlsCA  string
+	)
+
+	default_boards := os.Getenv("FIC_BOARDS")
+	if default_boards == "" {
+		default_boards = "localhost"
+	}
+
+	fs := flag.NewFlagSet("ficctl", flag.ExitOnError)
+	fs.StringVar(&boards, "b", default_boards, "Target boards host[:port], comma separated (default $FIC_BOARDS)")
+	fs.StringVar(&invf, "i", os.Getenv("FIC_INVENTORY"), "Inventory file, overrides -b (default $FIC_INVENTORY)")
+	fs.StringVar(&sel, "s", "all", "Boards of the inventory: names, tag:TAG or all, comma separated")
+	fs.IntVar(&par, "p", fleet.PARALLEL, "Boards operated at once")
+	fs.StringVar(&output, "o", "table", "Output format {table, json}")
+	fs.StringVar(&opts.Token, "token", os.Getenv("FIC_TOKEN"), "Auth token (default $FIC_TOKEN)")
+	fs.BoolVar(&useTls, "tls", false, "Use TLS")
+	fs.StringVar(&tlsCA, "tls-ca", "", "CA bundle to verify the daemon (PEM), implies -tls")
+	fs.DurationVar(&opts.Timeout, "timeout", client.DIAL_TIMEOUT * time.Second, "Connect timeout")
+	fs.Usage = func() { usage(fs) }
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() < 1 {
+		usage(fs)
+		os.Exit(EXIT_USAGE)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: Unknown command", fs.Arg(0))
+		usage(fs)
+		os.Exit(EXIT_USAGE)
+	}
+
+	switch output {
+	case "table":
+	case "json":
+		ctl.Json = true
+	default:
+		fmt.Fprintln(os.Stderr, "Error: Unknown output format", output)
+		os.Exit(EXIT_USAGE)
+	}
+
+	var inv *fleet.Inventory
+	if invf != "" {
+		var err error
+		if inv, err = fleet.Load(invf); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+		if opts.Token == "" {
+			opts.Token = inv.Token
+		}
+		useTls = useTls || inv.TLS
+		if tlsCA == "" {
+			tlsCA = inv.TLSCA
+		}
+	} else {
+		var addrs []string
+		for _, b := range strings.Split(boards, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				addrs = append(addrs, b)
+			}
+		}
+		inv = fleet.Adhoc(addrs)
+	}
+
+	targets, err := inv.Select(sel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(EXIT_USAGE)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No board")
+		os.Exit(EXIT_USAGE)
+	}
+
+	if opts.TLS, err = tls_client_config(useTls, tlsCA); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	ctl.Fleet = fleet.New(targets, opts)
+	ctl.Fleet.Parallel = par
+
+	// Ctrl-C cancels running requests
+	ctx, cancel := context.WithCancel(context.Background())
+	sig_ch := make(chan os.Signal, 1)
+	signal.Notify(sig_ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig_ch
+		cancel()
+	} ()
+
+	code := cmd.Run(ctx, &ctl, fs.Args()[1:])
+	ctl.Fleet.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,272 @@
+//-----------------------------------------------------------------------------
+// ficprog.go
+// nyacom (C) 2018.05
+// FiC FPGA Configurator
+// Programs locally through GPIO, or remotely through ficdaemon (-r)
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+	"bytes"
+	"context"
+	"syscall"
+	"io/ioutil"
+	"path/filepath"
+	"crypto/tls"
+	"crypto/x509"
+	"../../gpio"
+	"../../client"
+	"../../selectmap"
+)
+
+type Opts struct {
+	Mode     int
+	PR       bool
+	Remote   string
+	Token    string
+	Tls      bool
+	TlsCA    string
+	Verify   bool
+	DryRun   bool
+	Quiet    bool
+	Timeouts selectmap.Timeouts
+}
+
+//-----------------------------------------------------------------------------
+func init() {
+	fmt.Println("")
+	fmt.Println("FiC FPGA Configurator (golang ver)")
+	fmt.Println("nyacom (C) 2018.05 <kzh@nyacom.net>")
+}
+
+func help_str(fs *flag.FlagSet) {
+	fmt.Println("Usage: ficprog INPUT_FILE.{bit,bin} [options]")
+	fs.PrintDefaults()
+}
+
+// Progress line "PROG: sent / total (%)"
+func progress(quiet bool) func(int, int) {
+	if quiet {
+		return nil
+	}
+	return func(sent int, total int) {
+		if total == 0 {
+			return
+		}
+		fmt.Printf("\rPROG: %d / %d (%.2f %%)", sent, total, float32(sent) / float32(total) * 100)
+		if sent == total {
+			fmt.Println("")
+		}
+	}
+}
+
+// Canceled by SIGINT, SIGTERM, SIGHUP
+func signal_context()(context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig_ch := make(chan os.Signal, 1)
+	signal.Notify(sig_ch,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+
+	go func() {
+		sig := <-sig_ch
+		fmt.Println("\nINTR:", sig)
+		cancel()
+	} ()
+
+	return ctx
+}
+
+//-----------------------------------------------------------------------------
+// Local (GPIO)
+//-----------------------------------------------------------------------------
+func prog_local(ctx context.Context, bin []byte, o Opts) error {
+	if o.DryRun {
+		if h, err := gpio.Lock_holder(); err == nil && h.Pid != 0 && !h.Stale() {
+			fmt.Println("DRY-RUN: GPIO is locked by pid", h.Pid, h.Op, "since", h.Since)
+		}
+		fmt.Printf("DRY-RUN: Would program %d B in x%d mode (PR %v)\n", len(bin), o.Mode, o.PR)
+		return nil
+	}
+
+	if err := gpio.Setup(); err != nil {
+		return err
+	}
+	defer gpio.Close()
+
+	lctx, cancel := context.WithTimeout(ctx, gpio.LOCKTIMEOUT * time.Second)
+	err := gpio.Gpio_lock_ctx(lctx, "ficprog")
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer gpio.Gpio_unlock()
+
+	fmt.Printf("PROG: Entering Xilinx SelectMap x%d configuration mode...\n", o.Mode)
+	err = selectmap.Program(ctx, bin, selectmap.Options{
+		Width: o.Mode,
+		PR: o.PR,
+		Timeouts: o.Timeouts,
+		Progress: progress(o.Quiet),
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.Verify {
+		init, done := selectmap.Status()
+		if !init || (!o.PR && !done) {
+			return fmt.Errorf("verify failed (INIT %v, DONE %v)", init, done)
+		}
+		fmt.Println("VERIFY: INIT and DONE asserted")
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Remote (ficdaemon)
+//-----------------------------------------------------------------------------
+// The file is sent as is, the daemon records the .bit header
+func prog_remote(ctx context.Context, infile string, bin []byte, o Opts) error {
+	data, err := ioutil.ReadFile(infile)
+	if err != nil {
+		return err
+	}
+
+	copts := client.Options{Token: o.Token}
+	if o.Tls || o.TlsCA != "" {
+		copts.TLS = &tls.Config{}
+		if o.TlsCA != "" {
+			pem, err := ioutil.ReadFile(o.TlsCA)
+			if err != nil {
+				return err
+			}
+			copts.TLS.RootCAs = x509.NewCertPool()
+			copts.TLS.RootCAs.AppendCertsFromPEM(pem)
+		}
+	}
+
+	c, err := client.Dial(o.Remote, copts)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	fmt.Println("REMOTE:", c.Addr, "daemon", c.Version)
+
+	if o.DryRun {
+		st, err := c.StatusContext(ctx)
+		if err != nil {
+			return err
+		}
+		who, err := c.DoContext(ctx, "WHO", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("DRY-RUN: Board DONE %d PWR %d, lease %s\n", st.Done, st.Pwr, who)
+		fmt.Printf("DRY-RUN: Would program %d B in x%d mode (PR %v)\n", len(bin), o.Mode, o.PR)
+		return nil
+	}
+
+	c.Progress = progress(o.Quiet)
+	c.Queued = func(pos int) {
+		fmt.Println("PROG: Queued at", pos)
+	}
+
+	fmt.Printf("PROG: Sending %d B for x%d mode...\n", len(bin), o.Mode)
+	if err := c.ProgramNamedContext(ctx, bytes.NewReader(data), client.Mode(o.Mode), o.PR, filepath.Base(infile)); err != nil {
+		return err
+	}
+
+	if o.Verify && !o.PR {
+		st, err := c.StatusContext(ctx)
+		if err != nil {
+			return err
+		}
+		if st.Done != 1 {
+			return fmt.Errorf("verify failed (DONE %d)", st.Done)
+		}
+		fmt.Println("VERIFY: DONE asserted")
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+func main() {
+	var o Opts
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.IntVar(&o.Mode, "m", 16, "Selectmap mode {8, 16}")
+	fs.BoolVar(&o.PR, "c", false, "No-reset mode for PR (default Reset mode)")
+	fs.StringVar(&o.Remote, "r", "", "Program through ficdaemon at host[:port] instead of local GPIO")
+	fs.StringVar(&o.Token, "token", os.Getenv("FIC_TOKEN"), "Auth token for -r (default $FIC_TOKEN)")
+	fs.BoolVar(&o.Tls, "tls", false, "Use TLS for -r")
+	fs.StringVar(&o.TlsCA, "tls-ca", "", "CA bundle to verify the daemon (PEM), implies -tls")
+	fs.BoolVar(&o.Verify, "verify", false, "Check sync word before and DONE after programming")
+	fs.BoolVar(&o.DryRun, "n", false, "Dry-run, check the file and the target without programming")
+	fs.BoolVar(&o.Quiet, "q", false, "No progress output")
+	fs.DurationVar(&o.Timeouts.Init, "init-timeout", selectmap.DefaultTimeouts.Init, "Wait for INIT (local)")
+	fs.DurationVar(&o.Timeouts.Data, "data-timeout", selectmap.DefaultTimeouts.Data, "Send bitstream (local)")
+	fs.DurationVar(&o.Timeouts.Done, "done-timeout", selectmap.DefaultTimeouts.Done, "Wait for DONE (local)")
+
+	// Options are accepted before and after INPUT_FILE
+	fs.Parse(os.Args[1:])
+	args := fs.Args()
+	if len(args) < 1 || args[0] == "help" {
+		help_str(fs)
+		os.Exit(2)
+	}
+	infile := args[0]
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		help_str(fs)
+		os.Exit(2)
+	}
+
+	// Check options
+	if o.Mode != 8 && o.Mode != 16 {
+		fmt.Fprintln(os.Stderr, "Error: Invalid configurtaion mode")
+		os.Exit(2)
+	}
+
+	bin, info, err := selectmap.Load(infile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", infile, err)
+		os.Exit(1)
+	}
+	if info.Design != "" {
+		fmt.Println("FILE: Design", info.Design, "Part", info.Part, "Date", info.Date, info.Time)
+	}
+	fmt.Println("FILE: Size :", len(bin), "B")
+
+	if o.Verify || o.DryRun {
+		if err := selectmap.Check(bin, o.Mode); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := signal_context()
+
+	if o.Remote != "" {
+		err = prog_remote(ctx, infile, bin, o)
+	} else {
+		err = prog_local(ctx, bin, o)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if !o.DryRun {
+		fmt.Println("PROG: FPGA program done")
+	}
+}
@@ -6,11 +6,25 @@ package main
 
 import (
 	"time"
-	"errors"
+	"context"
+	"runtime"
+	"path/filepath"
 	"./gpio"	// RPi GPIO lib
 	"fmt"
 )
 
+//-----------------------------------------------------------------------------
+// GPIO lock with LOCKTIMEOUT, canceled with ctx
+//-----------------------------------------------------------------------------
+func fic_lock(ctx context.Context) error {
+	_, file, line, _ := runtime.Caller(1)
+
+	ctx, cancel := context.WithTimeout(ctx, gpio.LOCKTIMEOUT * time.Second)
+	defer cancel()
+
+	return gpio.Gpio_lock_ctx(ctx, fmt.Sprintf("%s:%d", filepath.Base(file), line))
+}
+
 //-----------------------------------------------------------------------------
 // GPIO pin setup for communication
 //-----------------------------------------------------------------------------
@@ -57,14 +71,17 @@ func comm_dir(dir int) {
 //-----------------------------------------------------------------------------
 // Wait until fack is down
 //-----------------------------------------------------------------------------
-func comm_wait_fack_down() error {
+func comm_wait_fack_down(ctx context.Context) error {
 	// Wait for ACK from FiC
 	t1 := time.Now()
 	for gpio.Get_pin(PIN_COMM["FACK"]) == 1 {
+		if ctx.Err() != nil {
+			return fic_error(ERR_CANCELED, "Communication canceled (fack_down)")
+		}
 		time.Sleep(1 * time.Millisecond)
 		t2 := time.Now()
 		if (t2.Sub(t1).Seconds() > COM_TIMEOUT) {
-			return errors.New("Communication time out (fack_down)")
+			return fic_error(ERR_COMM_TIMEOUT_FACK_DOWN, "Communication time out (fack_down)")
 		}
 	}
 	return nil
@@ -73,14 +90,17 @@ func comm_wait_fack_down() error {
 //-----------------------------------------------------------------------------
 // Wait until fack is up
 //-----------------------------------------------------------------------------
-func comm_wait_fack_up() error {
+func comm_wait_fack_up(ctx context.Context) error {
 	// Wait for ACK from FiC
 	t1 := time.Now()
 	for gpio.Get_pin(PIN_COMM["FACK"]) == 0 {
+		if ctx.Err() != nil {
+			return fic_error(ERR_CANCELED, "Communication canceled (fack_up)")
+		}
 		time.Sleep(1 * time.Millisecond)
 		t2 := time.Now()
 		if (t2.Sub(t1).Seconds() > COM_TIMEOUT) {
-			return errors.New("Communication time out (fack_up)")
+			return fic_error(ERR_COMM_TIMEOUT_FACK_UP, "Communication time out (fack_up)")
 		}
 	}
 	return nil
@@ -89,18 +109,18 @@ func comm_wait_fack_up() error {
 //-----------------------------------------------------------------------------
 // Send data bus
 //-----------------------------------------------------------------------------
-func comm_send(bus uint32) error {
+func comm_send(ctx context.Context, bus uint32) error {
 	gpio.Clr_bus(^(bus & COM_MASK))
 	gpio.Set_bus(bus & COM_MASK)
 
-	err := comm_wait_fack_up()	// Wait FiC ack up
+	err := comm_wait_fack_up(ctx)	// Wait FiC ack up
 	if err != nil {
 		return err
 	}
 
 	gpio.Clr_bus((1<<PIN_COMM["RSTB"]))	// Negate RPi stb 
 
-	err = comm_wait_fack_down()	// Wait FiC ack down
+	err = comm_wait_fack_down(ctx)	// Wait FiC ack down
 	if err != nil {
 		return err
 	}
@@ -111,14 +131,14 @@ func comm_send(bus uint32) error {
 //-----------------------------------------------------------------------------
 // Receive data bus
 //-----------------------------------------------------------------------------
-func comm_receive(bus uint32)(b uint8, err error) {
+func comm_receive(ctx context.Context, bus uint32)(b uint8, err error) {
 	// assert rstb
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])
 	gpio.Clr_bus(^(bus & COM_MASK))
 	gpio.Set_bus(bus & COM_MASK)
 	//fmt.Printf("DEBUG: send rstb %x\n", bus)
 
-	err = comm_wait_fack_up()	// Wait FiC ack up
+	err = comm_wait_fack_up(ctx)	// Wait FiC ack up
 	if err != nil {
 		fmt.Println("DEBUG: comm_receive timeout")
 		return 0, err
@@ -132,7 +152,7 @@ func comm_receive(bus uint32)(b uint8, err error) {
 	//gpio.Set_bus(bus & COM_MASK)
 	//fmt.Printf("DEBUG: send ~rstb %x\n", bus)
 
-	err = comm_wait_fack_down()	// Wait FiC ack down
+	err = comm_wait_fack_down(ctx)	// Wait FiC ack down
 	if err != nil {
 		return 0, err
 	}
@@ -143,12 +163,12 @@ func comm_receive(bus uint32)(b uint8, err error) {
 //-----------------------------------------------------------------------------
 // Set address
 //-----------------------------------------------------------------------------
-func comm_set_addr(addr uint16)(err error) {
+func comm_set_addr(ctx context.Context, addr uint16)(err error) {
 	// Note: Send write address 4times in 4bit mode
 	// Send address high-high (4bit)
 	bus := (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|((uint32(addr)>>12)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send addr high-high %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		//fmt.Println("DEBUG: send address high-high failed")
 		return err
@@ -157,7 +177,7 @@ func comm_set_addr(addr uint16)(err error) {
 	// Send address high-low (4bit)
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(((uint32(addr)>>8)&0x0f)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send addr high-low %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		//fmt.Println("DEBUG: send address high-low failed")
 		return err
@@ -166,7 +186,7 @@ func comm_set_addr(addr uint16)(err error) {
 	// Send address low-high (4bit)
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(((uint32(addr)>>4)&0x0f)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send addr low-high %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		//fmt.Println("DEBUG: send address low-high failed")
 		return err
@@ -175,7 +195,7 @@ func comm_set_addr(addr uint16)(err error) {
 	// Send address low-low (4bit)
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|((uint32(addr)&0x0f)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send addr low-low %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		//fmt.Println("DEBUG: send address low-low failed")
 		return err
@@ -186,26 +206,29 @@ func comm_set_addr(addr uint16)(err error) {
 
 // Write 1Byte 
 //-----------------------------------------------------------------------------
-func fic_write8(addr uint16, data uint8) error {
+func fic_write8(ctx context.Context, addr uint16, data uint8) error {
 	gpio_comm_setup()
+	defer gpio.Set_all_input()	// Also on error
 	comm_dir(COM_DIR_SND)
 
 	// Send Handshake and CMD
 	bus := uint32((1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(COM_CMD_WRITE<<PIN_COMM["DATA4"]))
-	err := comm_send(bus)
+	err := comm_send(ctx, bus)
 	if err != nil {
 		return err
 	}
 
 	// Set address
-	comm_set_addr(addr)
+	if err := comm_set_addr(ctx, addr); err != nil {
+		return err
+	}
 
 	// Note: Send data 2 times 
 
 	// Send data high (4bit)
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(uint32((data&0xf0)>>4)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send data high %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		return err
 	}
@@ -213,7 +236,7 @@ func fic_write8(addr uint16, data uint8) error {
 	// Send data low (4bit)
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(uint32(data&0x0f)<<PIN_COMM["DATA4"])
 	fmt.Printf("DEBUG: send data low %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		return err
 	}
@@ -221,37 +244,38 @@ func fic_write8(addr uint16, data uint8) error {
 	bus = (1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])
 	gpio.Clr_bus(^bus) // Negate REQ and STB
 
-	defer gpio.Set_all_input()
-
 	return nil
 }
 
 //-----------------------------------------------------------------------------
 // Read 1Byte 
 //-----------------------------------------------------------------------------
-func fic_read8(addr uint16)(b uint8, err error){
+func fic_read8(ctx context.Context, addr uint16)(b uint8, err error){
 	gpio_comm_setup()
+	defer gpio.Set_all_input()	// Also on error
 	comm_dir(COM_DIR_SND)
 
 	// Send Handshake and CMD
 	bus := uint32((1<<PIN_COMM["RREQ"])|(1<<PIN_COMM["RSTB"])|(COM_CMD_READ<<PIN_COMM["DATA4"]))
 	//fmt.Printf("DEBUG: send cmd %x\n", bus)
-	err = comm_send(bus)
+	err = comm_send(ctx, bus)
 	if err != nil {
 		//fmt.Println("DEBUG: send cmd failed")
 		return 0, err
 	}
 
 	// Set address
-	comm_set_addr(addr)
-	
+	if err := comm_set_addr(ctx, addr); err != nil {
+		return 0, err
+	}
+
 	// Switch bus direction
 	comm_dir(COM_DIR_RCV)
 
 	// Note: Read data 2 times..
 
 	// Read high 4bit
-	rcv, err := comm_receive(bus)
+	rcv, err := comm_receive(ctx, bus)
 	fmt.Printf("DEBUG: read bus high %x\n", rcv)
 	if err != nil {
 		return 0, err
@@ -259,14 +283,186 @@ func fic_read8(addr uint16)(b uint8, err error){
 	b = rcv & 0xf0
 
 	// Read low 4bit
-	rcv, err = comm_receive(bus)
+	rcv, err = comm_receive(ctx, bus)
 	fmt.Printf("DEBUG: read bus low %x\n", rcv)
 	if err != nil {
 		return 0, err
 	}
 	b |= (rcv & 0xf0) >> 4
 
-	defer gpio.Set_all_input()
+	return b, nil
+}
+
+//-----------------------------------------------------------------------------
+// Multi-byte register access
+// Note: Registers wider than 8bit are mapped onto consecutive byte addresses.
+//       endian selects which byte sits at the base address.
+//       latch selects the atomic-latch convention: reading the LSB latches
+//       the whole word on FiC side, and writing the LSB commits it. So the
+//       LSB is read first and written last. Otherwise bytes are accessed
+//       in ascending address order.
+//-----------------------------------------------------------------------------
+func comm_byte_order(addr uint16, width int, endian int, latch bool, write bool)(addrs []uint16, shifts []uint) {
+	for i := 0; i < width; i++ {
+		addrs = append(addrs, addr + uint16(i))
+		if endian == COM_ENDIAN_BIG {
+			shifts = append(shifts, uint(8 * (width - 1 - i)))
+		} else {
+			shifts = append(shifts, uint(8 * i))
+		}
+	}
+
+	if !latch {
+		return addrs, shifts
+	}
+
+	// Move the LSB (shift 0) to the head for read, to the tail for write
+	lsb := 0
+	for i, s := range shifts {
+		if s == 0 {
+			lsb = i
+		}
+	}
+	a, s := addrs[lsb], shifts[lsb]
+	addrs = append(addrs[:lsb], addrs[lsb+1:]...)
+	shifts = append(shifts[:lsb], shifts[lsb+1:]...)
+	if write {
+		addrs = append(addrs, a)
+		shifts = append(shifts, s)
+	} else {
+		addrs = append([]uint16{a}, addrs...)
+		shifts = append([]uint{s}, shifts...)
+	}
+
+	return addrs, shifts
+}
+
+func fic_read_n(ctx context.Context, addr uint16, width int, endian int, latch bool)(v uint64, err error) {
+	if int(addr) + width - 1 > 0xffff {
+		return 0, fic_error(ERR_BAD_ARGS, "Register address out of range")
+	}
+
+	addrs, shifts := comm_byte_order(addr, width, endian, latch, false)
+	for i, a := range addrs {
+		b, err := fic_read8(ctx, a)
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b) << shifts[i]
+	}
+
+	return v, nil
+}
+
+func fic_write_n(ctx context.Context, addr uint16, width int, data uint64, endian int, latch bool) error {
+	if int(addr) + width - 1 > 0xffff {
+		return fic_error(ERR_BAD_ARGS, "Register address out of range")
+	}
+
+	addrs, shifts := comm_byte_order(addr, width, endian, latch, true)
+	for i, a := range addrs {
+		err := fic_write8(ctx, a, uint8(data >> shifts[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Read 2/4/8Byte
+//-----------------------------------------------------------------------------
+func fic_read16(ctx context.Context, addr uint16, endian int, latch bool)(uint16, error) {
+	v, err := fic_read_n(ctx, addr, 2, endian, latch)
+	return uint16(v), err
+}
+
+func fic_read32(ctx context.Context, addr uint16, endian int, latch bool)(uint32, error) {
+	v, err := fic_read_n(ctx, addr, 4, endian, latch)
+	return uint32(v), err
+}
+
+func fic_read64(ctx context.Context, addr uint16, endian int, latch bool)(uint64, error) {
+	return fic_read_n(ctx, addr, 8, endian, latch)
+}
+
+//-----------------------------------------------------------------------------
+// Write 2/4/8Byte
+//-----------------------------------------------------------------------------
+func fic_write16(ctx context.Context, addr uint16, data uint16, endian int, latch bool) error {
+	return fic_write_n(ctx, addr, 2, uint64(data), endian, latch)
+}
+
+func fic_write32(ctx context.Context, addr uint16, data uint32, endian int, latch bool) error {
+	return fic_write_n(ctx, addr, 4, uint64(data), endian, latch)
+}
+
+func fic_write64(ctx context.Context, addr uint16, data uint64, endian int, latch bool) error {
+	return fic_write_n(ctx, addr, 8, data, endian, latch)
+}
+
+//-----------------------------------------------------------------------------
+// Read-modify-write 1Byte
+// Note: Caller must hold the GPIO lock over the whole sequence
+//-----------------------------------------------------------------------------
+func fic_rmw8(ctx context.Context, addr uint16, mask uint8, data uint8)(b uint8, err error) {
+	b, err = fic_read8(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	b = (b &^ mask) | (data & mask)
+
+	err = fic_write8(ctx, addr, b)
+	if err != nil {
+		return 0, err
+	}
 
 	return b, nil
 }
+
+func fic_setbits8(ctx context.Context, addr uint16, mask uint8)(uint8, error) {
+	return fic_rmw8(ctx, addr, mask, 0xff)
+}
+
+func fic_clrbits8(ctx context.Context, addr uint16, mask uint8)(uint8, error) {
+	return fic_rmw8(ctx, addr, mask, 0x00)
+}
+
+//-----------------------------------------------------------------------------
+// Poll 1Byte until (reg & mask) == (data & mask)
+// Note: Each poll is scheduled separately, so other clients can run in between
+//-----------------------------------------------------------------------------
+func fic_wait8(ctx context.Context, owner string, addr uint16, mask uint8, data uint8, timeout time.Duration, interval time.Duration)(b uint8, elapsed time.Duration, err error) {
+	t1 := time.Now()
+	for {
+		err = sched_run(ctx, "WAIT", owner, PRIO_NORMAL, nil, func() error {
+			if err := fic_lock(ctx); err != nil {
+				return err
+			}
+			defer gpio.Gpio_unlock()
+
+			b, err = fic_read8(ctx, addr)
+			return err
+		})
+		elapsed = time.Now().Sub(t1)
+		if err != nil {
+			return 0, elapsed, err
+		}
+
+		if b & mask == data & mask {
+			return b, elapsed, nil
+		}
+
+		if elapsed > timeout {
+			return b, elapsed, fic_errorf(ERR_WAIT_TIMEOUT, "Register wait time out (last %x)", b)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return b, elapsed, fic_error(ERR_CANCELED, "Register wait canceled")
+		}
+	}
+}
@@ -1,7 +1,20 @@
 package main
 
+import (
+	"./selectmap"
+)
+
 //-----------------------------------------------------------------------------
 const (
+	// Daemon version
+	DAEMON_VERSION = "0.2.0"
+
+	// Terminal protocol version
+	PROTOCOL_VERSION = 1
+
+	// Board profile
+	BOARD_PROFILE = "FiC-SW"
+
 	// FiC status get period in sec
 	GET_STATUS_PEIROD = 5
 
@@ -18,76 +31,89 @@ const (
 
 	COM_MASK = 0x00cfff00
 
+	// Multi-byte register byte order
+	COM_ENDIAN_LITTLE = 0	// LSB at base address
+	COM_ENDIAN_BIG    = 1	// MSB at base address
+
+	// Register poll interval for WAIT in msec
+	WAIT_POLL_PERIOD = 10
+
+	// Ports of FIC_REG_LINKUP and FIC_REG_CHUP (bit N is port N)
+	FIC_PORTS = 8
+
+	// Link is flapping with LINK_FLAP_COUNT changes in LINK_FLAP_WINDOW sec
+	LINK_FLAP_COUNT  = 3
+	LINK_FLAP_WINDOW = 300
+
 	// TCP config
 	LISTEN_ADDR = "0.0.0.0:4000"
 
+	// JSON-RPC config
+	RPC_LISTEN_ADDR = "0.0.0.0:4001"
+	RPC_SOCK_PATH   = "/tmp/ficdaemon.sock"
+	RPC_SOCK_PERM   = 0660
+
+	// Auth policy file
+	AUTH_CONFIG_PATH = "/etc/ficdaemon/auth.json"
+
+	// Board lease duration in sec
+	LEASE_DEFAULT = 3600
+	LEASE_MAX     = 8*3600
+
+	// Audit log
+	AUDIT_LOG_PATH    = "/var/log/ficdaemon_audit.log"
+	AUDIT_LOG_MAXSIZE = (10*1024*1024)
+	AUDIT_LOG_KEEP    = 5
+	AUDIT_QUERY_COUNT = 20
+
+	// Last programmed bitstream
+	BITSTREAM_STATE_PATH = "/var/lib/ficdaemon/bitstream.json"
+	BITSTREAM_NAME_MAX   = 255	// File name given by the client
+
+	// Partial reconfiguration bases and partitions
+	PR_CONFIG_PATH = "/etc/ficdaemon/pr.json"
+
+	// Max wait in hardware operation queue in sec
+	SCHED_DEADLINE = 120
+
+	// Shutdown (sec), wait for the running hardware operation
+	SHUTDOWN_TIMEOUT = 30
+
+	// TLS handshake (sec), before the session is authenticated
+	TLS_HANDSHAKE_TIMEOUT = 10
+
+	// gRPC config (build with -tags grpc)
+	GRPC_LISTEN_ADDR = "0.0.0.0:4002"
+
 	BUFSIZE = (1*1024*1024)
 )
 
 //-----------------------------------------------------------------------------
-// PRi PINS
+// Framed protocol
 //-----------------------------------------------------------------------------
-var PIN = map[string] uint32 {
-	"RP_INIT" : 4,
-	"RP_PROG" : 5,
-	"RP_DONE" : 6,
-	"RP_CCLK" : 7,
-
-	"RP_CD0" : 8,
-	"RP_CD1" : 9,
-	"RP_CD2" : 10,
-	"RP_CD3" : 11,
-	"RP_CD4" : 12,
-	"RP_CD5" : 13,
-	"RP_CD6" : 14,
-	"RP_CD7" : 15,
-	"RP_CD8" : 16,
-	"RP_CD9" : 17,
-	"RP_CD10" : 18,
-	"RP_CD11" : 19,
-	"RP_CD12" : 20,
-	"RP_CD13" : 21,
-	"RP_CD14" : 22,
-	"RP_CD15" : 23,
-	"RP_CD16" : 24,
-	"RP_CD17" : 25,
-
-	"RP_PWOK" : 24,
-	"RP_G_CKSEL" : 25,
-	"RP_CSI" : 26,
-	"RP_RDWR" : 27,
-}
+const (
+	FRAME_MAGIC   = "FICF"		// Sent by client to select framed protocol
+	FRAME_VERSION = 1
+	FRAME_HDRSIZE = 4 + 1 + 4	// len + type + id
+	FRAME_MAXSIZE = (256*1024*1024)	// Authorized PROG data
+	FRAME_SMALLSIZE = (64*1024)	// Any other frame, also before HELLO and AUTH
+	FRAME_PIPELINE = 16		// Requests read ahead of execution
+
+	// Frame types
+	FRAME_HELLO = 0x01	// Version handshake (payload: version uint16)
+	FRAME_REQ   = 0x02	// Request (payload: cmdlen uint16, cmd, data)
+	FRAME_RESP  = 0x03	// Success response (payload: body)
+	FRAME_ERR   = 0x04	// Error response (payload: code uint16, "name: message")
+	FRAME_CANCEL = 0x05	// Cancel pending request id (no payload)
+	FRAME_QUEUED = 0x06	// Request is queued (payload: position uint32)
+)
 
-var PIN_BIT = map[string] uint32 {
-	"RP_PWOK" : (1 << PIN["RP_PWOK"]),	// Input
-	"RP_INIT" : (1 << PIN["RP_INIT"]),
-	"RP_DONE" : (1 << PIN["RP_DONE"]),
-	"RP_G_CKSEL" : (1 << PIN["RP_G_CKSEL"]),
-
-	"RP_CD0" : (1 << PIN["RP_CD0"]),	// Output
-	"RP_CD1" : (1 << PIN["RP_CD1"]),
-	"RP_CD2" : (1 << PIN["RP_CD2"]),
-	"RP_CD3" : (1 << PIN["RP_CD3"]),
-	"RP_CD4" : (1 << PIN["RP_CD4"]),
-	"RP_CD5" : (1 << PIN["RP_CD5"]),
-	"RP_CD6" : (1 << PIN["RP_CD6"]),
-	"RP_CD7" : (1 << PIN["RP_CD7"]),
-	"RP_CD8" : (1 << PIN["RP_CD8"]),
-	"RP_CD9" : (1 << PIN["RP_CD9"]),
-	"RP_CD10" : (1 << PIN["RP_CD10"]),
-	"RP_CD11" : (1 << PIN["RP_CD11"]),
-	"RP_CD12" : (1 << PIN["RP_CD12"]),
-	"RP_CD13" : (1 << PIN["RP_CD13"]),
-	"RP_CD14" : (1 << PIN["RP_CD14"]),
-	"RP_CD15" : (1 << PIN["RP_CD15"]),
-	"RP_CD16" : (1 << PIN["RP_CD16"]),
-	"RP_CD17" : (1 << PIN["RP_CD17"]),
-
-	"RP_PROG" : (1 << PIN["RP_PROG"]),
-	"RP_CCLK" : (1 << PIN["RP_CCLK"]),
-	"RP_CSI" : (1 << PIN["RP_CSI"]),
-	"RP_RDWR" : (1 << PIN["RP_RDWR"]),
-}
+//-----------------------------------------------------------------------------
+// PRi PINS
+//-----------------------------------------------------------------------------
+// Shared with ficprog, see ./selectmap
+var PIN = selectmap.PIN
+var PIN_BIT = selectmap.PIN_BIT
 
 //-----------------------------------------------------------------------------
 // FiC registers
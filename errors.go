@@ -0,0 +1,127 @@
+//-----------------------------------------------------------------------------
+// errors.go
+// nyacom (C) 2018.05
+// Error taxonomy reported over the protocol
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"errors"
+	"./gpio"	// RPi GPIO lib
+	"./selectmap"
+)
+
+//-----------------------------------------------------------------------------
+// Error codes
+//-----------------------------------------------------------------------------
+const (
+	ERR_INTERNAL           = "internal"
+	ERR_BAD_ARGS           = "bad_args"
+	ERR_UNKNOWN_CMD        = "unknown_cmd"
+	ERR_LOCK_TIMEOUT       = "lock_timeout"
+	ERR_COMM_TIMEOUT_FACK_UP   = "comm_timeout_fack_up"
+	ERR_COMM_TIMEOUT_FACK_DOWN = "comm_timeout_fack_down"
+	ERR_CONFIG_INIT_LOW    = "config_init_low"
+	ERR_SIZE_MISMATCH      = "size_mismatch"
+	ERR_WAIT_TIMEOUT       = "wait_timeout"
+	ERR_JSON               = "json"
+	ERR_BAD_FRAME          = "bad_frame"
+	ERR_VERSION_MISMATCH   = "version_mismatch"
+	ERR_NO_HELLO           = "no_hello"
+	ERR_AUTH_REQUIRED      = "auth_required"
+	ERR_AUTH_FAILED        = "auth_failed"
+	ERR_FORBIDDEN          = "forbidden"
+	ERR_LEASE_HELD         = "lease_held"
+	ERR_NO_LEASE           = "no_lease"
+	ERR_CANCELED           = "canceled"
+	ERR_QUEUE_TIMEOUT      = "queue_timeout"
+	ERR_PROG_INIT_TIMEOUT  = "prog_init_timeout"
+	ERR_PROG_DATA_TIMEOUT  = "prog_data_timeout"
+	ERR_PROG_DONE_TIMEOUT  = "prog_done_timeout"
+	ERR_PR_MISMATCH        = "pr_mismatch"
+	ERR_NOT_CONFIGURED     = "not_configured"
+)
+
+// Numeric codes for the framed protocol (do not renumber)
+var fic_err_num = map[string]uint16 {
+	ERR_INTERNAL:               1,
+	ERR_BAD_ARGS:               2,
+	ERR_UNKNOWN_CMD:            3,
+	ERR_LOCK_TIMEOUT:           4,
+	ERR_COMM_TIMEOUT_FACK_UP:   5,
+	ERR_COMM_TIMEOUT_FACK_DOWN: 6,
+	ERR_CONFIG_INIT_LOW:        7,
+	ERR_SIZE_MISMATCH:          8,
+	ERR_WAIT_TIMEOUT:           9,
+	ERR_JSON:                   10,
+	ERR_BAD_FRAME:              11,
+	ERR_VERSION_MISMATCH:       12,
+	ERR_NO_HELLO:               13,
+	ERR_AUTH_REQUIRED:          14,
+	ERR_AUTH_FAILED:            15,
+	ERR_FORBIDDEN:              16,
+	ERR_LEASE_HELD:             17,
+	ERR_NO_LEASE:               18,
+	ERR_CANCELED:               19,
+	ERR_QUEUE_TIMEOUT:          20,
+	ERR_PROG_INIT_TIMEOUT:      21,
+	ERR_PROG_DATA_TIMEOUT:      22,
+	ERR_PROG_DONE_TIMEOUT:      23,
+	ERR_PR_MISMATCH:            24,
+	ERR_NOT_CONFIGURED:         25,
+}
+
+//-----------------------------------------------------------------------------
+type FicError struct {
+	Code string	// One of ERR_*
+	Msg  string	// Human readable message
+}
+
+func (e *FicError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+func (e *FicError) Num() uint16 {
+	return fic_err_num[e.Code]
+}
+
+func fic_error(code string, msg string) error {
+	return &FicError{Code: code, Msg: msg}
+}
+
+func fic_errorf(code string, format string, a ...interface{}) error {
+	return &FicError{Code: code, Msg: fmt.Sprintf(format, a...)}
+}
+
+// FPGA configuration errors
+var selectmap_err_code = map[error]string {
+	selectmap.ErrWidth:       ERR_BAD_ARGS,
+	selectmap.ErrOddSize:     ERR_BAD_ARGS,
+	selectmap.ErrInitTimeout: ERR_PROG_INIT_TIMEOUT,
+	selectmap.ErrDataTimeout: ERR_PROG_DATA_TIMEOUT,
+	selectmap.ErrDoneTimeout: ERR_PROG_DONE_TIMEOUT,
+	selectmap.ErrInitLow:     ERR_CONFIG_INIT_LOW,
+	selectmap.ErrInitLowDone: ERR_CONFIG_INIT_LOW,
+	selectmap.ErrCanceled:    ERR_CANCELED,
+}
+
+// Classify any error into FicError
+func fic_error_of(err error) *FicError {
+	var fe *FicError
+	if errors.As(err, &fe) {
+		return fe
+	}
+
+	if errors.Is(err, gpio.ErrLockTimeout) {
+		return &FicError{Code: ERR_LOCK_TIMEOUT, Msg: err.Error()}
+	}
+	if errors.Is(err, gpio.ErrLockCanceled) {
+		return &FicError{Code: ERR_CANCELED, Msg: err.Error()}
+	}
+	if code, ok := selectmap_err_code[err]; ok {
+		return &FicError{Code: code, Msg: err.Error()}
+	}
+
+	return &FicError{Code: ERR_INTERNAL, Msg: err.Error()}
+}
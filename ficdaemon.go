@@ -7,19 +7,24 @@ package main
 import (
 	"fmt"
 //	"errors"
-//	"flag"
+	"flag"
 	"log"
-//	"os"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	"context"
+	"io"
 	"net"		// socket
+	"bufio"
 	"strings"
 	"strconv"
-	"encoding/json"
+	"sync"
 	"./gpio"	// RPi GPIO lib
+	"./ficsim"
 //	"ficprog"
 //	"unsafe"
 //	"reflect"
-//	"syscall"
 )
 
 //-----------------------------------------------------------------------------
@@ -46,26 +51,70 @@ func gpio_prog_setup() {
 //-----------------------------------------------------------------------------
 // User module control
 //-----------------------------------------------------------------------------
-// func fic_module_reset() {
-// }
-// func fic_module_start() {
-// }
+// The reset and start bits of FIC_REG_ST are defined by the user design,
+// not by the FiC register map, so they are set with -reset-bit and -start-bit
+// Note: Reset and start bits share FIC_REG_ST with other bits,
+//       so they are pulsed with read-modify-write under the GPIO lock
+var (
+	fic_st_reset uint	// 0: not configured
+	fic_st_start uint
+)
+
+func fic_module_pulse(ctx context.Context, name string, mask uint) error {
+	if mask == 0 {
+		return fic_errorf(ERR_NOT_CONFIGURED, "%s bit of FIC_REG_ST is not configured (-%s-bit)", name, strings.ToLower(name))
+	}
+	bit := uint8(mask)
+
+	err := fic_lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer gpio.Gpio_unlock()
+
+	if _, err := fic_setbits8(ctx, FIC_REG_ST, bit); err != nil {
+		return err
+	}
+	if _, err := fic_clrbits8(ctx, FIC_REG_ST, bit); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func fic_module_reset(ctx context.Context) error {
+	return fic_module_pulse(ctx, "RESET", fic_st_reset)
+}
+
+func fic_module_start(ctx context.Context) error {
+	return fic_module_pulse(ctx, "START", fic_st_start)
+}
 
 //-----------------------------------------------------------------------------
 // FPGA reset
 //-----------------------------------------------------------------------------
-func fic_fpga_init() {
+func fic_fpga_init(ctx context.Context) error {
+	err := fic_lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer gpio.Gpio_unlock()
+
 	gpio_prog_setup() // GPIO setup for FPGA prog
 	defer gpio.Set_all_input()
 	gpio.Set_bus(PIN_BIT["RP_PROG"])
 	gpio.Clr_bus(PIN_BIT["RP_PROG"])
+	bitstream_invalidate("INIT")
+	link_reset()
+
+	return nil
 }
 
 ////-----------------------------------------------------------------------------
 //// FPGA programmer
 ////-----------------------------------------------------------------------------
 //func fic_prog(bitstream []byte)(err error) {
-//	if lock := gpio.Gpio_lock(); lock == false {
+//	if lock := fic_lock(ctx); lock == false {
 //		return errors.New("GPIO cant lock")
 //	}
 //	defer gpio.Gpio_unlock()
@@ -138,59 +187,157 @@ type FicStat struct {
 	Chup   uint8		`json:"chup"`		// Ch. up
 	Done   uint8		`json:"done"`		// FPGA done
 	Pwr    uint8		`json:"pwr"`		// PWR OK
+	Ports  []FicPort	`json:"ports"`		// Linkup and Chup per port
+	Bitstream *BitRecord	`json:"bitstream"`	// Last programmed, null if unknown
 }
 
-func monitor_get_status()(st FicStat, err error) {
-	err = gpio.Gpio_lock()
+func monitor_get_status(ctx context.Context)(st FicStat, err error) {
+	err = fic_lock(ctx)
 	if err != nil {
 		return st, err
 	}
 	defer gpio.Gpio_unlock()
 
 	st.Ts		= time.Now()
-	st.State, err	= fic_read8(FIC_REG_ST)
-	st.Hls, err	= fic_read8(FIC_REG_HLS)
-	st.Linkup, err	= fic_read8(FIC_REG_LINKUP)
-	st.Dipsw, err	= fic_read8(FIC_REG_DIPSW)
-	st.Led, err	= fic_read8(FIC_REG_LED)
-	st.Chup, err	= fic_read8(FIC_REG_CHUP)
+	st.State, err	= fic_read8(ctx, FIC_REG_ST)
+	st.Hls, err	= fic_read8(ctx, FIC_REG_HLS)
+	st.Linkup, err	= fic_read8(ctx, FIC_REG_LINKUP)
+	st.Dipsw, err	= fic_read8(ctx, FIC_REG_DIPSW)
+	st.Led, err	= fic_read8(ctx, FIC_REG_LED)
+	st.Chup, err	= fic_read8(ctx, FIC_REG_CHUP)
 	st.Done		= uint8(gpio.Get_pin(PIN["RP_DONE"]))
 	st.Pwr		= uint8(gpio.Get_pin(PIN["RP_PWOK"]))
 
+	if err == nil {
+		link_update(&st)
+	}
+	bitstream_check_done(st.Done)
+	st.Bitstream = bitstream_current()
+
+	return st, err
+}
+
+// The status is shared by the refresh loop and the connections
+var mon_mu sync.RWMutex
+
+func monitor_load(mon *FicStat)(FicStat) {
+	mon_mu.RLock()
+	defer mon_mu.RUnlock()
+	return *mon
+}
+
+func monitor_store(mon *FicStat, st FicStat) {
+	mon_mu.Lock()
+	defer mon_mu.Unlock()
+	*mon = st
+}
+
+// Update mon after the board is changed (PROG, INIT)
+// Note: Called in the scheduled operation
+func monitor_refresh(ctx context.Context, mon *FicStat) {
+	st, err := monitor_get_status(ctx)
+	if err != nil {
+		fmt.Println("DEBUG: FiC STATUS GET ERROR (REFRESH)", err)
+		return
+	}
+	monitor_store(mon, st)
+}
+
+// Status through the hardware operation scheduler
+func monitor_get_status_sched(ctx context.Context, owner string, prio int)(st FicStat, err error) {
+	err = sched_run(ctx, "STATUS", owner, prio, nil, func() error {
+		st, err = monitor_get_status(ctx)
+		return err
+	})
 	return st, err
 }
 
 //-----------------------------------------------------------------------------
 // Kernel
 //-----------------------------------------------------------------------------
+// gRPC server, set by grpc.go when built with -tags grpc
+var grpc_daemon func(addr string, mon *FicStat)
+
+// Daemon lifetime, canceled by SIGINT/SIGTERM
+// Sessions are derived from it, so queued operations are canceled too
+var daemon_ctx, daemon_stop = context.WithCancel(context.Background())
+
+// Main TCP listener (-listen), JSON-RPC TCP listener (-rpc, "" to disable)
+var listen_addr = LISTEN_ADDR
+var rpc_addr = RPC_LISTEN_ADDR
+
+// Stop accepting on shutdown
+func monitor_close_on_shutdown(listener net.Listener) {
+	go func() {
+		<-daemon_ctx.Done()
+		listener.Close()
+	} ()
+}
+
 func monitor_daemon() {
-	listener, err := net.Listen("tcp", LISTEN_ADDR)
+	listener, err := tls_listen("tcp", listen_addr)
 	if err != nil {
 		log.Fatal("Can't listen", err)
 	}
 	defer listener.Close()
+	monitor_close_on_shutdown(listener)
+	fmt.Println("FiCDaemon: Listen on ", listen_addr)
 
 	// Obtain monitor status async
-	mon, err := monitor_get_status()
+	mon, err := monitor_get_status_sched(context.Background(), "daemon", PRIO_BACKGROUND)
 	if err != nil {
 		fmt.Println("DEBUG: FiC STATUS GET ERROR (INITIAL)", err)
 	}
-	mon_t0 := time.Now()
 
-	// kernel loop
-	for {
-		// Refresh monitor info
-		if time.Now().Sub(mon_t0).Seconds() > GET_STATUS_PEIROD  {
-			mon, err = monitor_get_status()
-			mon_t0 = time.Now()
+	// Auth policy
+	if err := auth_load(AUTH_CONFIG_PATH, false); err != nil {
+		log.Fatal("Can't load auth policy ", err)
+	}
+
+	// Partial reconfiguration
+	if err := pr_load(pr_path, false); err != nil {
+		log.Fatal("Can't load PR config ", err)
+	}
+
+	// JSON-RPC listeners
+	if rpc_addr != "" {
+		go rpc_daemon("tcp", rpc_addr, &mon)
+	}
+	go rpc_daemon("unix", RPC_SOCK_PATH, &mon)
+
+	// gRPC listener
+	if grpc_daemon != nil {
+		go grpc_daemon(GRPC_LISTEN_ADDR, &mon)
+	}
+
+	// Refresh monitor info
+	go func() {
+		ticker := time.NewTicker(GET_STATUS_PEIROD * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-daemon_ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			st, err := monitor_get_status_sched(daemon_ctx, "daemon", PRIO_BACKGROUND)
 			if err != nil {
 				fmt.Println("DEBUG: FiC STATUS GET ERROR (PERIOD)", err)
+				continue
 			}
+			monitor_store(&mon, st)
 		}
+	} ()
 
+	// kernel loop
+	for {
 		// Socket accept
 		conn, err := listener.Accept()
 		if err != nil {
+			if daemon_ctx.Err() != nil {
+				return	// Shutdown
+			}
 			log.Fatal("Can't accept", err)
 		}
 
@@ -198,202 +345,194 @@ func monitor_daemon() {
 	}
 }
 
+// Reload certificates, auth policy and PR config
+func monitor_reload() {
+	if err := tls_load(); err != nil {
+		fmt.Println("ERROR: TLS reload", err)
+	}
+	if err := auth_load(AUTH_CONFIG_PATH, true); err != nil {
+		fmt.Println("ERROR: Auth policy reload", err)
+	}
+	if err := pr_load(pr_path, true); err != nil {
+		fmt.Println("ERROR: PR config reload", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Shutdown (after monitor_daemon returned)
+// Waits for the running hardware operation, then leaves the pins as input
+//-----------------------------------------------------------------------------
+func monitor_shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT * time.Second)
+	defer cancel()
+
+	// Hold the scheduler forever, no hardware operation runs after this
+	if _, err := sched_acquire(ctx, "SHUTDOWN", "daemon", PRIO_SHUTDOWN, nil); err != nil {
+		fmt.Println("WARNING: Hardware operation still running at shutdown", err)
+	}
+
+	if err := gpio.Gpio_lock_ctx(ctx, "shutdown"); err != nil {
+		// Still in use, the kernel releases the lock at exit
+		fmt.Println("WARNING: Can't lock GPIO at shutdown", err)
+		gpio.Set_all_input()
+		return
+	}
+
+	gpio.Set_all_input()
+	gpio.Gpio_unlock()
+	gpio.Close()
+
+	fmt.Println("FiCDaemon: Shutdown")
+}
+
 func monitor_resp_ok(conn net.Conn) {
 	conn.Write([]byte("OK\r\n"))
 }
 
-func monitor_resp_err(conn net.Conn) {
-	conn.Write([]byte("ERROR\r\n"))
+// Error response: ERROR <code> <message>
+func monitor_resp_err(conn net.Conn, err error) {
+	fe := fic_error_of(err)
+	conn.Write([]byte("ERROR " + fe.Code + " " + fe.Msg + "\r\n"))
 }
 
 func monitor_sock_conn(conn net.Conn, mon *FicStat) {
 	defer conn.Close()
 
-	// Terminal commands
-	const (
-		TERM_CMD_STAT     = "STAT"
-		TERM_CMD_PROG     = "PROG"
-		TERM_CMD_PROG_PR  = "PROGPR"
-		TERM_CMD_PROG8    = "PROG8"
-		TERM_CMD_PROG8_PR = "PROG8PR"
-		TERM_CMD_START    = "STAT"
-		TERM_CMD_RESET    = "RESET"
-		TERM_CMD_WRITE    = "WRITE"
-		TERM_CMD_READ     = "READ"
-		TERM_CMD_HELP     = "HELP"
-		TERM_CMD_INIT     = "INIT"	// FPGA INIT
-	)
+	fmt.Println("FiCDaemon: Connected from", conn.RemoteAddr())
+
+	s, err := session_from_conn(conn)
+	if err != nil {
+		fmt.Println("DEBUG: Session error", conn.RemoteAddr(), err)
+		return
+	}
+	defer s.Close()	// Cancel queued operations
+
+	// Note: The first prompt is always sent in text.
+	//       Framed clients skip it and send FRAME_MAGIC to switch protocol
+	monitor_resp_ok(conn)	// Ready for recieve CMD
+
+	r := bufio.NewReaderSize(conn, 8*1024)
+	magic, err := r.Peek(len(FRAME_MAGIC))
+	if err == nil && string(magic) == FRAME_MAGIC {
+		r.Discard(len(FRAME_MAGIC))
+		s.Proto = "framed"
+		monitor_frame_conn(conn, r, s, mon)
+	} else {
+		s.Proto = "text"
+		monitor_text_conn(conn, r, s, mon)
+	}
+
+	fmt.Println("DEBUG: Disconnected from", conn.RemoteAddr())
+}
+
+// Close session if the peer disconnects while a command is running
+// Returns stop function to be called before the next read
+func monitor_watch_disconnect(conn net.Conn, r *bufio.Reader, s *Session) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := r.Peek(1); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return
+			}
+			fmt.Println("DEBUG: Disconnected during command", s.Addr)
+			s.Close()
+		}
+	} ()
+
+	return func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
 
+//-----------------------------------------------------------------------------
+// Legacy text protocol
+//-----------------------------------------------------------------------------
+// Accept PROG before the bitstream is received, OK is sent once the command
+// is allowed and once the size is valid (the client waits for both)
+func monitor_text_prog_size(conn net.Conn, s *Session, b []string)(int, error) {
+	if len(b) < 2 {
+		return 0, fic_error(ERR_BAD_ARGS, "PROG ARG ERROR")
+	}
+	if err := auth_check(s, b[0]); err != nil {
+		return 0, err
+	}
+	if err := lease_check(s, b[0]); err != nil {
+		return 0, err
+	}
+	monitor_resp_ok(conn)
+
+	// 2nd argument is recive data size
+	rcvsize, err := strconv.Atoi(b[1])
+	if err != nil || rcvsize < 0 {
+		return 0, fic_error(ERR_BAD_ARGS, "PROG ARG SIZE ERROR")
+	}
+	if rcvsize > FRAME_MAXSIZE {
+		return 0, fic_errorf(ERR_BAD_ARGS, "Bitstream larger than %d B", FRAME_MAXSIZE)
+	}
+	return rcvsize, nil
+}
+
+func monitor_text_conn(conn net.Conn, r *bufio.Reader, s *Session, mon *FicStat) {
 	buf := make([]byte, 8*1024)
 
-	fmt.Println("FiCDaemon: Listen on ", LISTEN_ADDR)
 	for {
-		monitor_resp_ok(conn)	// Ready for recieve CMD
-		n, err := conn.Read(buf)
+		n, err := r.Read(buf)
 		if n == 0 {
 			break
 		}
 		if err != nil {
-			monitor_resp_err(conn)
-			log.Fatal("ERROR: Read buffer error", err)
+			monitor_resp_err(conn, err)
+			fmt.Println("ERROR: Read buffer error", err)
+			break
 		}
 
 		b := strings.Fields(string(buf[:n]))
+		if len(b) == 0 {
+			monitor_resp_ok(conn)
+			continue
+		}
 
-		switch b[0] {
-		// Report status
-		case TERM_CMD_STAT:
-			fmt.Println("DEBUG: STAT")
-
-			//st, err := monitor_get_status()
-			//if err != nil {
-			//	fmt.Println("DEBUG: STATUS GET ERROR", err)
-			//}
-
-			jsonbyte, err := json.Marshal(*mon)
-			if err != nil {
-				fmt.Println("DEBUG: JSON ERROR")
-				monitor_resp_err(conn)
-				break
-			}
-
-			conn.Write(append(jsonbyte, []byte("\r\n")...))
+		var data []byte
 
-		// FPGA Configuration
+		switch b[0] {
+		// FPGA Configuration: receive bitstream before execution
 		case TERM_CMD_PROG, TERM_CMD_PROG8, TERM_CMD_PROG_PR, TERM_CMD_PROG8_PR:
-			fmt.Println("DEBUG: PROG", len(b))
-			if len(b) < 2 {
-				fmt.Println("DEBUG: PROG ARG ERROR")
-				monitor_resp_err(conn)
-				break
-			}
-			monitor_resp_ok(conn)
-
-			// 2nd argument is recive data size
-			rcvsize, err := strconv.Atoi(b[1])
+			rcvsize, err := monitor_text_prog_size(conn, s, b)
 			if err != nil {
-				fmt.Println("DEBUG: PROG ARG SIZE ERROR")
-				monitor_resp_err(conn)
-				break
+				// The client sends the bitstream anyway, it must not be
+				// read as commands
+				audit_record(s, b[0], b[1:], nil, time.Now(), err)
+				monitor_resp_err(conn, err)
+				return
 			}
 			fmt.Println("DEBUG: RCV SIZE", rcvsize)
-			rcvdata := make([]byte, rcvsize)
+			data = make([]byte, rcvsize)
 			monitor_resp_ok(conn)
 
 			// Receive FPGA bitstream data
-			i := 0
-			for i < rcvsize {
-				n, err := conn.Read(buf)
-				if n == 0 {
-					//fmt.Println("DEBUG: read", n)
-					break
-				}
-				if err != nil {
-					monitor_resp_err(conn)
-					fmt.Println("ERROR: Read buffer error", err)
-					break
-				}
-				//fmt.Println("DEBUG: read", n)
-				copy(rcvdata[i:], buf)
-				i += n
-			}
-
+			i, err := io.ReadFull(r, data)
 			fmt.Println("DEBUG: RCVD SIZE", i)
-
-			if i != rcvsize {
-				fmt.Println("DEBUG: Recived bitstream size mismatch ", rcvsize - i)
-				monitor_resp_err(conn)
-				break
-			}
-
-			// Send to FPGA
-			switch b[0] {
-			case TERM_CMD_PROG, TERM_CMD_PROG_PR:
-				pr := false
-				if b[0] == TERM_CMD_PROG_PR {
-					pr = true
-				}
-
-				if err := Prog16(rcvdata, pr); err != nil {
-					monitor_resp_err(conn)
-					fmt.Println("ERROR: FPGA programming error", err)
-					break
-				}
-
-			case TERM_CMD_PROG8, TERM_CMD_PROG8_PR:
-				pr := false
-				if b[0] == TERM_CMD_PROG8_PR {
-					pr = true
-				}
-
-				if err := Prog8(rcvdata, pr); err != nil {
-					monitor_resp_err(conn)
-					fmt.Println("ERROR: FPGA programming error", err)
-					break
-				}
-			}
-
-			fmt.Println("DEBUG: PROG DONE")
-
-		// Register Write
-		case TERM_CMD_WRITE:
-			fmt.Println("DEBUG: WRITE")
-			if len(b) < 3 {
-				fmt.Println("DEBUG: WRITE ARG ERROR")
-				monitor_resp_err(conn)
-				break
-			}
-			// 2nd argument is write 1b address
-			addr, err := strconv.ParseInt(b[1], 16, 32)
 			if err != nil {
-				fmt.Println("DEBUG: WRITE ARG ADDR ERROR", err)
-				monitor_resp_err(conn)
-				break
-			}
-			// 3rd argument is write data (1byte)
-			data, err := strconv.ParseInt(b[2], 16, 32)
-			if err != nil {
-				fmt.Println("DEBUG: WRITE ARG DATA ERROR", err)
-				monitor_resp_err(conn)
-				break
-			}
-			fic_write8(uint16(addr), uint8(data))
-
-		// Register Read
-		case TERM_CMD_READ:
-			fmt.Println("DEBUG: READ")
-			if len(b) < 2 {
-				fmt.Println("DEBUG: READ ARG ERROR")
-				monitor_resp_err(conn)
-				break
+				fmt.Println("ERROR: Read buffer error", err)
+				data = data[:i]
 			}
-			// 2nd argument is read address
-			addr, err := strconv.ParseInt(b[1], 16, 32)
-			if err != nil {
-				fmt.Println("DEBUG: READ ARG ADDR ERROR", err)
-				monitor_resp_err(conn)
-				break
-			}
-
-			data, err := fic_read8(uint16(addr))
-			//data, err := fic_read4(uint8(addr))
-			if err != nil {
-				fmt.Println("DEBUG: READ DATA ERROR", err)
-				monitor_resp_err(conn)
-				break
-			}
-
-			// send back
-			conn.Write([]byte(strconv.FormatInt(int64(data), 16)+"\r\n"))
+		}
 
-		// FPGA reset
-		case TERM_CMD_INIT:
-			fmt.Println("DEBUG: INIT")
-			fic_fpga_init()
+		stop := monitor_watch_disconnect(conn, r, s)
+		resp, err := monitor_exec(s, b, data, mon)
+		stop()
+		if err != nil {
+			fmt.Println("DEBUG:", b[0], "ERROR", err)
+			monitor_resp_err(conn, err)
+		} else if resp != nil {
+			conn.Write(append(resp, []byte("\r\n")...))
 		}
-	}
 
-	fmt.Println("DEBUG: Disconnected from", conn.RemoteAddr())
+		monitor_resp_ok(conn)	// Ready for recieve CMD
+	}
 }
 
 //-----------------------------------------------------------------------------
@@ -406,8 +545,69 @@ func init() {
 }
 
 func main() {
-	 gpio.Setup()	// GPIO setup (mmap)
+	var opts TlsOpts
+	var sim bool
+	flag.StringVar(&listen_addr, "listen", LISTEN_ADDR, "TCP listen address")
+	flag.StringVar(&rpc_addr, "rpc", RPC_LISTEN_ADDR, "JSON-RPC TCP listen address (\"\" to disable)")
+	flag.BoolVar(&sim, "sim", false, "Run on a simulated FiC board instead of GPIO")
+	flag.StringVar(&bitstream_path, "state", BITSTREAM_STATE_PATH, "Last programmed bitstream state file")
+	flag.StringVar(&audit_log_path, "audit-log", AUDIT_LOG_PATH, "Audit log file")
+	flag.StringVar(&pr_path, "pr-config", PR_CONFIG_PATH, "Partial reconfiguration bases and partitions")
+	flag.StringVar(&opts.Cert, "tls-cert", "", "TLS certificate (PEM), enables TLS on TCP listeners")
+	flag.StringVar(&opts.Key, "tls-key", "", "TLS private key (PEM)")
+	flag.StringVar(&opts.ClientCA, "tls-client-ca", "", "CA bundle for client certificates (PEM)")
+	flag.StringVar(&opts.ClientAuth, "tls-client-auth", TLS_CLIENT_NONE, "Client certificate mode {none, optional, require}")
+	flag.DurationVar(&prog_timeouts.Init, "prog-init-timeout", prog_timeouts.Init, "FPGA configuration: wait for INIT")
+	flag.DurationVar(&prog_timeouts.Data, "prog-data-timeout", prog_timeouts.Data, "FPGA configuration: send bitstream")
+	flag.DurationVar(&prog_timeouts.Done, "prog-done-timeout", prog_timeouts.Done, "FPGA configuration: wait for DONE")
+	flag.UintVar(&fic_st_reset, "reset-bit", 0, "FIC_REG_ST bit mask pulsed by RESET (defined by the user design, 0: RESET fails)")
+	flag.UintVar(&fic_st_start, "start-bit", 0, "FIC_REG_ST bit mask pulsed by START (defined by the user design, 0: START fails)")
+	flag.Parse()
+
+	if fic_st_reset > 0xff || fic_st_start > 0xff {
+		log.Fatal("Invalid -reset-bit or -start-bit, FIC_REG_ST is 8bit")
+	}
+	if fic_st_reset == 0 || fic_st_start == 0 {
+		fmt.Println("WARNING: No -reset-bit or -start-bit, RESET and START fail with", ERR_NOT_CONFIGURED)
+	}
+
+	if err := tls_setup(opts); err != nil {
+		log.Fatal("Can't setup TLS ", err)
+	}
+
+	// Signal handling
+	// SIGHUP: reload certificates, auth policy and PR config
+	// SIGINT, SIGTERM: shutdown (twice: exit immediately)
+	sig_ch := make(chan os.Signal, 1)
+	signal.Notify(sig_ch, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range sig_ch {
+			switch sig {
+			case syscall.SIGHUP:
+				fmt.Println("INTR: SIGHUP, reloading")
+				monitor_reload()
+
+			default:
+				if daemon_ctx.Err() != nil {
+					fmt.Println("INTR:", sig, "exit immediately")
+					gpio.Set_all_input()
+					os.Exit(1)
+				}
+				fmt.Println("INTR:", sig, "shutting down")
+				daemon_stop()
+			}
+		}
+	} ()
+
+	if sim {
+		gpio.Setup_sim(ficsim.New())
+		fmt.Println("FiCDaemon: Simulated FiC board")
+	} else {
+		gpio.Setup()	// GPIO setup (mmap)
+	}
+	bitstream_load()
 	 monitor_daemon()
+	 monitor_shutdown()
 
 	// ---- R/W test ----
 	// fmt.Printf("%x\n", fic_read8(0xfffc))
@@ -0,0 +1,1209 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: ficrpc/fic.proto
+
+package ficrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ProgMode int32
+
+const (
+	ProgMode_PROG_MODE_X16 ProgMode = 0
+	ProgMode_PROG_MODE_X8  ProgMode = 1
+)
+
+// Enum value maps for ProgMode.
+var (
+	ProgMode_name = map[int32]string{
+		0: "PROG_MODE_X16",
+		1: "PROG_MODE_X8",
+	}
+	ProgMode_value = map[string]int32{
+		"PROG_MODE_X16": 0,
+		"PROG_MODE_X8":  1,
+	}
+)
+
+func (x ProgMode) Enum() *ProgMode {
+	p := new(ProgMode)
+	*p = x
+	return p
+}
+
+func (x ProgMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProgMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_ficrpc_fic_proto_enumTypes[0].Descriptor()
+}
+
+func (ProgMode) Type() protoreflect.EnumType {
+	return &file_ficrpc_fic_proto_enumTypes[0]
+}
+
+func (x ProgMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProgMode.Descriptor instead.
+func (ProgMode) EnumDescriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{0}
+}
+
+type ProgramChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mode          ProgMode               `protobuf:"varint,1,opt,name=mode,proto3,enum=ficrpc.ProgMode" json:"mode,omitempty"`
+	Pr            bool                   `protobuf:"varint,2,opt,name=pr,proto3" json:"pr,omitempty"`
+	TotalSize     uint32                 `protobuf:"varint,3,opt,name=total_size,json=totalSize,proto3" json:"total_size,omitempty"`
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	Name          string                 `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgramChunk) Reset() {
+	*x = ProgramChunk{}
+	mi := &file_ficrpc_fic_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgramChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgramChunk) ProtoMessage() {}
+
+func (x *ProgramChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgramChunk.ProtoReflect.Descriptor instead.
+func (*ProgramChunk) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ProgramChunk) GetMode() ProgMode {
+	if x != nil {
+		return x.Mode
+	}
+	return ProgMode_PROG_MODE_X16
+}
+
+func (x *ProgramChunk) GetPr() bool {
+	if x != nil {
+		return x.Pr
+	}
+	return false
+}
+
+func (x *ProgramChunk) GetTotalSize() uint32 {
+	if x != nil {
+		return x.TotalSize
+	}
+	return 0
+}
+
+func (x *ProgramChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ProgramChunk) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ProgramResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Size          uint32                 `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	ElapsedSec    float64                `protobuf:"fixed64,2,opt,name=elapsed_sec,json=elapsedSec,proto3" json:"elapsed_sec,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgramResult) Reset() {
+	*x = ProgramResult{}
+	mi := &file_ficrpc_fic_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgramResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgramResult) ProtoMessage() {}
+
+func (x *ProgramResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgramResult.ProtoReflect.Descriptor instead.
+func (*ProgramResult) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ProgramResult) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ProgramResult) GetElapsedSec() float64 {
+	if x != nil {
+		return x.ElapsedSec
+	}
+	return 0
+}
+
+type WatchStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PeriodMs      uint32                 `protobuf:"varint,1,opt,name=period_ms,json=periodMs,proto3" json:"period_ms,omitempty"`
+	Refresh       bool                   `protobuf:"varint,2,opt,name=refresh,proto3" json:"refresh,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStatusRequest) Reset() {
+	*x = WatchStatusRequest{}
+	mi := &file_ficrpc_fic_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStatusRequest) ProtoMessage() {}
+
+func (x *WatchStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStatusRequest.ProtoReflect.Descriptor instead.
+func (*WatchStatusRequest) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *WatchStatusRequest) GetPeriodMs() uint32 {
+	if x != nil {
+		return x.PeriodMs
+	}
+	return 0
+}
+
+func (x *WatchStatusRequest) GetRefresh() bool {
+	if x != nil {
+		return x.Refresh
+	}
+	return false
+}
+
+type FicStat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TsUnixNano    int64                  `protobuf:"varint,1,opt,name=ts_unix_nano,json=tsUnixNano,proto3" json:"ts_unix_nano,omitempty"`
+	State         uint32                 `protobuf:"varint,2,opt,name=state,proto3" json:"state,omitempty"`
+	Hls           uint32                 `protobuf:"varint,3,opt,name=hls,proto3" json:"hls,omitempty"`
+	Linkup        uint32                 `protobuf:"varint,4,opt,name=linkup,proto3" json:"linkup,omitempty"`
+	Dipsw         uint32                 `protobuf:"varint,5,opt,name=dipsw,proto3" json:"dipsw,omitempty"`
+	Led           uint32                 `protobuf:"varint,6,opt,name=led,proto3" json:"led,omitempty"`
+	Chup          uint32                 `protobuf:"varint,7,opt,name=chup,proto3" json:"chup,omitempty"`
+	Done          uint32                 `protobuf:"varint,8,opt,name=done,proto3" json:"done,omitempty"`
+	Pwr           uint32                 `protobuf:"varint,9,opt,name=pwr,proto3" json:"pwr,omitempty"`
+	Ports         []*FicPort             `protobuf:"bytes,10,rep,name=ports,proto3" json:"ports,omitempty"`
+	Bitstream     *BitRecord             `protobuf:"bytes,11,opt,name=bitstream,proto3" json:"bitstream,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FicStat) Reset() {
+	*x = FicStat{}
+	mi := &file_ficrpc_fic_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FicStat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FicStat) ProtoMessage() {}
+
+func (x *FicStat) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FicStat.ProtoReflect.Descriptor instead.
+func (*FicStat) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FicStat) GetTsUnixNano() int64 {
+	if x != nil {
+		return x.TsUnixNano
+	}
+	return 0
+}
+
+func (x *FicStat) GetState() uint32 {
+	if x != nil {
+		return x.State
+	}
+	return 0
+}
+
+func (x *FicStat) GetHls() uint32 {
+	if x != nil {
+		return x.Hls
+	}
+	return 0
+}
+
+func (x *FicStat) GetLinkup() uint32 {
+	if x != nil {
+		return x.Linkup
+	}
+	return 0
+}
+
+func (x *FicStat) GetDipsw() uint32 {
+	if x != nil {
+		return x.Dipsw
+	}
+	return 0
+}
+
+func (x *FicStat) GetLed() uint32 {
+	if x != nil {
+		return x.Led
+	}
+	return 0
+}
+
+func (x *FicStat) GetChup() uint32 {
+	if x != nil {
+		return x.Chup
+	}
+	return 0
+}
+
+func (x *FicStat) GetDone() uint32 {
+	if x != nil {
+		return x.Done
+	}
+	return 0
+}
+
+func (x *FicStat) GetPwr() uint32 {
+	if x != nil {
+		return x.Pwr
+	}
+	return 0
+}
+
+func (x *FicStat) GetPorts() []*FicPort {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *FicStat) GetBitstream() *BitRecord {
+	if x != nil {
+		return x.Bitstream
+	}
+	return nil
+}
+
+type FicPort struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Port          uint32                 `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
+	Link          bool                   `protobuf:"varint,2,opt,name=link,proto3" json:"link,omitempty"`
+	Chup          bool                   `protobuf:"varint,3,opt,name=chup,proto3" json:"chup,omitempty"`
+	SinceUnixNano int64                  `protobuf:"varint,4,opt,name=since_unix_nano,json=sinceUnixNano,proto3" json:"since_unix_nano,omitempty"`
+	Changes       uint32                 `protobuf:"varint,5,opt,name=changes,proto3" json:"changes,omitempty"`
+	Flapping      bool                   `protobuf:"varint,6,opt,name=flapping,proto3" json:"flapping,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FicPort) Reset() {
+	*x = FicPort{}
+	mi := &file_ficrpc_fic_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FicPort) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FicPort) ProtoMessage() {}
+
+func (x *FicPort) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FicPort.ProtoReflect.Descriptor instead.
+func (*FicPort) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FicPort) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *FicPort) GetLink() bool {
+	if x != nil {
+		return x.Link
+	}
+	return false
+}
+
+func (x *FicPort) GetChup() bool {
+	if x != nil {
+		return x.Chup
+	}
+	return false
+}
+
+func (x *FicPort) GetSinceUnixNano() int64 {
+	if x != nil {
+		return x.SinceUnixNano
+	}
+	return 0
+}
+
+func (x *FicPort) GetChanges() uint32 {
+	if x != nil {
+		return x.Changes
+	}
+	return 0
+}
+
+func (x *FicPort) GetFlapping() bool {
+	if x != nil {
+		return x.Flapping
+	}
+	return false
+}
+
+type BitRecord struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Sha256             string                 `protobuf:"bytes,1,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	Size               uint32                 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Name               string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Bit                *BitInfo               `protobuf:"bytes,4,opt,name=bit,proto3" json:"bit,omitempty"`
+	Width              uint32                 `protobuf:"varint,5,opt,name=width,proto3" json:"width,omitempty"`
+	Pr                 bool                   `protobuf:"varint,6,opt,name=pr,proto3" json:"pr,omitempty"`
+	ProgrammedUnixNano int64                  `protobuf:"varint,7,opt,name=programmed_unix_nano,json=programmedUnixNano,proto3" json:"programmed_unix_nano,omitempty"`
+	Client             string                 `protobuf:"bytes,8,opt,name=client,proto3" json:"client,omitempty"`
+	Base               string                 `protobuf:"bytes,9,opt,name=base,proto3" json:"base,omitempty"`
+	Partitions         map[string]*PrLoaded   `protobuf:"bytes,10,rep,name=partitions,proto3" json:"partitions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Partial            *BitRecord             `protobuf:"bytes,11,opt,name=partial,proto3" json:"partial,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *BitRecord) Reset() {
+	*x = BitRecord{}
+	mi := &file_ficrpc_fic_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BitRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BitRecord) ProtoMessage() {}
+
+func (x *BitRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BitRecord.ProtoReflect.Descriptor instead.
+func (*BitRecord) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BitRecord) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *BitRecord) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *BitRecord) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BitRecord) GetBit() *BitInfo {
+	if x != nil {
+		return x.Bit
+	}
+	return nil
+}
+
+func (x *BitRecord) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *BitRecord) GetPr() bool {
+	if x != nil {
+		return x.Pr
+	}
+	return false
+}
+
+func (x *BitRecord) GetProgrammedUnixNano() int64 {
+	if x != nil {
+		return x.ProgrammedUnixNano
+	}
+	return 0
+}
+
+func (x *BitRecord) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *BitRecord) GetBase() string {
+	if x != nil {
+		return x.Base
+	}
+	return ""
+}
+
+func (x *BitRecord) GetPartitions() map[string]*PrLoaded {
+	if x != nil {
+		return x.Partitions
+	}
+	return nil
+}
+
+func (x *BitRecord) GetPartial() *BitRecord {
+	if x != nil {
+		return x.Partial
+	}
+	return nil
+}
+
+type BitInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Design        string                 `protobuf:"bytes,1,opt,name=design,proto3" json:"design,omitempty"`
+	Part          string                 `protobuf:"bytes,2,opt,name=part,proto3" json:"part,omitempty"`
+	Date          string                 `protobuf:"bytes,3,opt,name=date,proto3" json:"date,omitempty"`
+	Time          string                 `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	Size          uint32                 `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BitInfo) Reset() {
+	*x = BitInfo{}
+	mi := &file_ficrpc_fic_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BitInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BitInfo) ProtoMessage() {}
+
+func (x *BitInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BitInfo.ProtoReflect.Descriptor instead.
+func (*BitInfo) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BitInfo) GetDesign() string {
+	if x != nil {
+		return x.Design
+	}
+	return ""
+}
+
+func (x *BitInfo) GetPart() string {
+	if x != nil {
+		return x.Part
+	}
+	return ""
+}
+
+func (x *BitInfo) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *BitInfo) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *BitInfo) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type PrLoaded struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Module             string                 `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	Sha256             string                 `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	ProgrammedUnixNano int64                  `protobuf:"varint,3,opt,name=programmed_unix_nano,json=programmedUnixNano,proto3" json:"programmed_unix_nano,omitempty"`
+	Client             string                 `protobuf:"bytes,4,opt,name=client,proto3" json:"client,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *PrLoaded) Reset() {
+	*x = PrLoaded{}
+	mi := &file_ficrpc_fic_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrLoaded) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrLoaded) ProtoMessage() {}
+
+func (x *PrLoaded) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrLoaded.ProtoReflect.Descriptor instead.
+func (*PrLoaded) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PrLoaded) GetModule() string {
+	if x != nil {
+		return x.Module
+	}
+	return ""
+}
+
+func (x *PrLoaded) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *PrLoaded) GetProgrammedUnixNano() int64 {
+	if x != nil {
+		return x.ProgrammedUnixNano
+	}
+	return 0
+}
+
+func (x *PrLoaded) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+type ReadRegisterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          uint32                 `protobuf:"varint,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Width         uint32                 `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	BigEndian     bool                   `protobuf:"varint,3,opt,name=big_endian,json=bigEndian,proto3" json:"big_endian,omitempty"`
+	Latch         bool                   `protobuf:"varint,4,opt,name=latch,proto3" json:"latch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadRegisterRequest) Reset() {
+	*x = ReadRegisterRequest{}
+	mi := &file_ficrpc_fic_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadRegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadRegisterRequest) ProtoMessage() {}
+
+func (x *ReadRegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadRegisterRequest.ProtoReflect.Descriptor instead.
+func (*ReadRegisterRequest) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ReadRegisterRequest) GetAddr() uint32 {
+	if x != nil {
+		return x.Addr
+	}
+	return 0
+}
+
+func (x *ReadRegisterRequest) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *ReadRegisterRequest) GetBigEndian() bool {
+	if x != nil {
+		return x.BigEndian
+	}
+	return false
+}
+
+func (x *ReadRegisterRequest) GetLatch() bool {
+	if x != nil {
+		return x.Latch
+	}
+	return false
+}
+
+type RegisterValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          uint32                 `protobuf:"varint,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Value         uint64                 `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterValue) Reset() {
+	*x = RegisterValue{}
+	mi := &file_ficrpc_fic_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterValue) ProtoMessage() {}
+
+func (x *RegisterValue) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterValue.ProtoReflect.Descriptor instead.
+func (*RegisterValue) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RegisterValue) GetAddr() uint32 {
+	if x != nil {
+		return x.Addr
+	}
+	return 0
+}
+
+func (x *RegisterValue) GetValue() uint64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+type WriteRegisterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          uint32                 `protobuf:"varint,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Value         uint64                 `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+	Width         uint32                 `protobuf:"varint,3,opt,name=width,proto3" json:"width,omitempty"`
+	BigEndian     bool                   `protobuf:"varint,4,opt,name=big_endian,json=bigEndian,proto3" json:"big_endian,omitempty"`
+	Latch         bool                   `protobuf:"varint,5,opt,name=latch,proto3" json:"latch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRegisterRequest) Reset() {
+	*x = WriteRegisterRequest{}
+	mi := &file_ficrpc_fic_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRegisterRequest) ProtoMessage() {}
+
+func (x *WriteRegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRegisterRequest.ProtoReflect.Descriptor instead.
+func (*WriteRegisterRequest) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WriteRegisterRequest) GetAddr() uint32 {
+	if x != nil {
+		return x.Addr
+	}
+	return 0
+}
+
+func (x *WriteRegisterRequest) GetValue() uint64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *WriteRegisterRequest) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *WriteRegisterRequest) GetBigEndian() bool {
+	if x != nil {
+		return x.BigEndian
+	}
+	return false
+}
+
+func (x *WriteRegisterRequest) GetLatch() bool {
+	if x != nil {
+		return x.Latch
+	}
+	return false
+}
+
+type WriteRegisterResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRegisterResponse) Reset() {
+	*x = WriteRegisterResponse{}
+	mi := &file_ficrpc_fic_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRegisterResponse) ProtoMessage() {}
+
+func (x *WriteRegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRegisterResponse.ProtoReflect.Descriptor instead.
+func (*WriteRegisterResponse) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{11}
+}
+
+type InitFPGARequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InitFPGARequest) Reset() {
+	*x = InitFPGARequest{}
+	mi := &file_ficrpc_fic_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InitFPGARequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InitFPGARequest) ProtoMessage() {}
+
+func (x *InitFPGARequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InitFPGARequest.ProtoReflect.Descriptor instead.
+func (*InitFPGARequest) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{12}
+}
+
+type InitFPGAResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InitFPGAResponse) Reset() {
+	*x = InitFPGAResponse{}
+	mi := &file_ficrpc_fic_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InitFPGAResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InitFPGAResponse) ProtoMessage() {}
+
+func (x *InitFPGAResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ficrpc_fic_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InitFPGAResponse.ProtoReflect.Descriptor instead.
+func (*InitFPGAResponse) Descriptor() ([]byte, []int) {
+	return file_ficrpc_fic_proto_rawDescGZIP(), []int{13}
+}
+
+var File_ficrpc_fic_proto protoreflect.FileDescriptor
+
+const file_ficrpc_fic_proto_rawDesc = "" +
+	"\n" +
+	"\x10ficrpc/fic.proto\x12\x06ficrpc\"\x8b\x01\n" +
+	"\fProgramChunk\x12$\n" +
+	"\x04mode\x18\x01 \x01(\x0e2\x10.ficrpc.ProgModeR\x04mode\x12\x0e\n" +
+	"\x02pr\x18\x02 \x01(\bR\x02pr\x12\x1d\n" +
+	"\n" +
+	"total_size\x18\x03 \x01(\rR\ttotalSize\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\"D\n" +
+	"\rProgramResult\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\rR\x04size\x12\x1f\n" +
+	"\velapsed_sec\x18\x02 \x01(\x01R\n" +
+	"elapsedSec\"K\n" +
+	"\x12WatchStatusRequest\x12\x1b\n" +
+	"\tperiod_ms\x18\x01 \x01(\rR\bperiodMs\x12\x18\n" +
+	"\arefresh\x18\x02 \x01(\bR\arefresh\"\xa5\x02\n" +
+	"\aFicStat\x12 \n" +
+	"\fts_unix_nano\x18\x01 \x01(\x03R\n" +
+	"tsUnixNano\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\rR\x05state\x12\x10\n" +
+	"\x03hls\x18\x03 \x01(\rR\x03hls\x12\x16\n" +
+	"\x06linkup\x18\x04 \x01(\rR\x06linkup\x12\x14\n" +
+	"\x05dipsw\x18\x05 \x01(\rR\x05dipsw\x12\x10\n" +
+	"\x03led\x18\x06 \x01(\rR\x03led\x12\x12\n" +
+	"\x04chup\x18\a \x01(\rR\x04chup\x12\x12\n" +
+	"\x04done\x18\b \x01(\rR\x04done\x12\x10\n" +
+	"\x03pwr\x18\t \x01(\rR\x03pwr\x12%\n" +
+	"\x05ports\x18\n" +
+	" \x03(\v2\x0f.ficrpc.FicPortR\x05ports\x12/\n" +
+	"\tbitstream\x18\v \x01(\v2\x11.ficrpc.BitRecordR\tbitstream\"\xa3\x01\n" +
+	"\aFicPort\x12\x12\n" +
+	"\x04port\x18\x01 \x01(\rR\x04port\x12\x12\n" +
+	"\x04link\x18\x02 \x01(\bR\x04link\x12\x12\n" +
+	"\x04chup\x18\x03 \x01(\bR\x04chup\x12&\n" +
+	"\x0fsince_unix_nano\x18\x04 \x01(\x03R\rsinceUnixNano\x12\x18\n" +
+	"\achanges\x18\x05 \x01(\rR\achanges\x12\x1a\n" +
+	"\bflapping\x18\x06 \x01(\bR\bflapping\"\xb3\x03\n" +
+	"\tBitRecord\x12\x16\n" +
+	"\x06sha256\x18\x01 \x01(\tR\x06sha256\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\rR\x04size\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12!\n" +
+	"\x03bit\x18\x04 \x01(\v2\x0f.ficrpc.BitInfoR\x03bit\x12\x14\n" +
+	"\x05width\x18\x05 \x01(\rR\x05width\x12\x0e\n" +
+	"\x02pr\x18\x06 \x01(\bR\x02pr\x120\n" +
+	"\x14programmed_unix_nano\x18\a \x01(\x03R\x12programmedUnixNano\x12\x16\n" +
+	"\x06client\x18\b \x01(\tR\x06client\x12\x12\n" +
+	"\x04base\x18\t \x01(\tR\x04base\x12A\n" +
+	"\n" +
+	"partitions\x18\n" +
+	" \x03(\v2!.ficrpc.BitRecord.PartitionsEntryR\n" +
+	"partitions\x12+\n" +
+	"\apartial\x18\v \x01(\v2\x11.ficrpc.BitRecordR\apartial\x1aO\n" +
+	"\x0fPartitionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12&\n" +
+	"\x05value\x18\x02 \x01(\v2\x10.ficrpc.PrLoadedR\x05value:\x028\x01\"q\n" +
+	"\aBitInfo\x12\x16\n" +
+	"\x06design\x18\x01 \x01(\tR\x06design\x12\x12\n" +
+	"\x04part\x18\x02 \x01(\tR\x04part\x12\x12\n" +
+	"\x04date\x18\x03 \x01(\tR\x04date\x12\x12\n" +
+	"\x04time\x18\x04 \x01(\tR\x04time\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\rR\x04size\"\x84\x01\n" +
+	"\bPrLoaded\x12\x16\n" +
+	"\x06module\x18\x01 \x01(\tR\x06module\x12\x16\n" +
+	"\x06sha256\x18\x02 \x01(\tR\x06sha256\x120\n" +
+	"\x14programmed_unix_nano\x18\x03 \x01(\x03R\x12programmedUnixNano\x12\x16\n" +
+	"\x06client\x18\x04 \x01(\tR\x06client\"t\n" +
+	"\x13ReadRegisterRequest\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\rR\x04addr\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\rR\x05width\x12\x1d\n" +
+	"\n" +
+	"big_endian\x18\x03 \x01(\bR\tbigEndian\x12\x14\n" +
+	"\x05latch\x18\x04 \x01(\bR\x05latch\"9\n" +
+	"\rRegisterValue\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\rR\x04addr\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value\"\x8b\x01\n" +
+	"\x14WriteRegisterRequest\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\rR\x04addr\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value\x12\x14\n" +
+	"\x05width\x18\x03 \x01(\rR\x05width\x12\x1d\n" +
+	"\n" +
+	"big_endian\x18\x04 \x01(\bR\tbigEndian\x12\x14\n" +
+	"\x05latch\x18\x05 \x01(\bR\x05latch\"\x17\n" +
+	"\x15WriteRegisterResponse\"\x11\n" +
+	"\x0fInitFPGARequest\"\x12\n" +
+	"\x10InitFPGAResponse*/\n" +
+	"\bProgMode\x12\x11\n" +
+	"\rPROG_MODE_X16\x10\x00\x12\x10\n" +
+	"\fPROG_MODE_X8\x10\x012\xd5\x02\n" +
+	"\n" +
+	"FicService\x128\n" +
+	"\aProgram\x12\x14.ficrpc.ProgramChunk\x1a\x15.ficrpc.ProgramResult(\x01\x12<\n" +
+	"\vWatchStatus\x12\x1a.ficrpc.WatchStatusRequest\x1a\x0f.ficrpc.FicStat0\x01\x12B\n" +
+	"\fReadRegister\x12\x1b.ficrpc.ReadRegisterRequest\x1a\x15.ficrpc.RegisterValue\x12L\n" +
+	"\rWriteRegister\x12\x1c.ficrpc.WriteRegisterRequest\x1a\x1d.ficrpc.WriteRegisterResponse\x12=\n" +
+	"\bInitFPGA\x12\x17.ficrpc.InitFPGARequest\x1a\x18.ficrpc.InitFPGAResponseB\x11Z\x0f./ficrpc;ficrpcb\x06proto3"
+
+var (
+	file_ficrpc_fic_proto_rawDescOnce sync.Once
+	file_ficrpc_fic_proto_rawDescData []byte
+)
+
+func file_ficrpc_fic_proto_rawDescGZIP() []byte {
+	file_ficrpc_fic_proto_rawDescOnce.Do(func() {
+		file_ficrpc_fic_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ficrpc_fic_proto_rawDesc), len(file_ficrpc_fic_proto_rawDesc)))
+	})
+	return file_ficrpc_fic_proto_rawDescData
+}
+
+var file_ficrpc_fic_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_ficrpc_fic_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_ficrpc_fic_proto_goTypes = []any{
+	(ProgMode)(0),                 // 0: ficrpc.ProgMode
+	(*ProgramChunk)(nil),          // 1: ficrpc.ProgramChunk
+	(*ProgramResult)(nil),         // 2: ficrpc.ProgramResult
+	(*WatchStatusRequest)(nil),    // 3: ficrpc.WatchStatusRequest
+	(*FicStat)(nil),               // 4: ficrpc.FicStat
+	(*FicPort)(nil),               // 5: ficrpc.FicPort
+	(*BitRecord)(nil),             // 6: ficrpc.BitRecord
+	(*BitInfo)(nil),               // 7: ficrpc.BitInfo
+	(*PrLoaded)(nil),              // 8: ficrpc.PrLoaded
+	(*ReadRegisterRequest)(nil),   // 9: ficrpc.ReadRegisterRequest
+	(*RegisterValue)(nil),         // 10: ficrpc.RegisterValue
+	(*WriteRegisterRequest)(nil),  // 11: ficrpc.WriteRegisterRequest
+	(*WriteRegisterResponse)(nil), // 12: ficrpc.WriteRegisterResponse
+	(*InitFPGARequest)(nil),       // 13: ficrpc.InitFPGARequest
+	(*InitFPGAResponse)(nil),      // 14: ficrpc.InitFPGAResponse
+	nil,                           // 15: ficrpc.BitRecord.PartitionsEntry
+}
+var file_ficrpc_fic_proto_depIdxs = []int32{
+	0,  // 0: ficrpc.ProgramChunk.mode:type_name -> ficrpc.ProgMode
+	5,  // 1: ficrpc.FicStat.ports:type_name -> ficrpc.FicPort
+	6,  // 2: ficrpc.FicStat.bitstream:type_name -> ficrpc.BitRecord
+	7,  // 3: ficrpc.BitRecord.bit:type_name -> ficrpc.BitInfo
+	15, // 4: ficrpc.BitRecord.partitions:type_name -> ficrpc.BitRecord.PartitionsEntry
+	6,  // 5: ficrpc.BitRecord.partial:type_name -> ficrpc.BitRecord
+	8,  // 6: ficrpc.BitRecord.PartitionsEntry.value:type_name -> ficrpc.PrLoaded
+	1,  // 7: ficrpc.FicService.Program:input_type -> ficrpc.ProgramChunk
+	3,  // 8: ficrpc.FicService.WatchStatus:input_type -> ficrpc.WatchStatusRequest
+	9,  // 9: ficrpc.FicService.ReadRegister:input_type -> ficrpc.ReadRegisterRequest
+	11, // 10: ficrpc.FicService.WriteRegister:input_type -> ficrpc.WriteRegisterRequest
+	13, // 11: ficrpc.FicService.InitFPGA:input_type -> ficrpc.InitFPGARequest
+	2,  // 12: ficrpc.FicService.Program:output_type -> ficrpc.ProgramResult
+	4,  // 13: ficrpc.FicService.WatchStatus:output_type -> ficrpc.FicStat
+	10, // 14: ficrpc.FicService.ReadRegister:output_type -> ficrpc.RegisterValue
+	12, // 15: ficrpc.FicService.WriteRegister:output_type -> ficrpc.WriteRegisterResponse
+	14, // 16: ficrpc.FicService.InitFPGA:output_type -> ficrpc.InitFPGAResponse
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_ficrpc_fic_proto_init() }
+func file_ficrpc_fic_proto_init() {
+	if File_ficrpc_fic_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ficrpc_fic_proto_rawDesc), len(file_ficrpc_fic_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ficrpc_fic_proto_goTypes,
+		DependencyIndexes: file_ficrpc_fic_proto_depIdxs,
+		EnumInfos:         file_ficrpc_fic_proto_enumTypes,
+		MessageInfos:      file_ficrpc_fic_proto_msgTypes,
+	}.Build()
+	File_ficrpc_fic_proto = out.File
+	file_ficrpc_fic_proto_goTypes = nil
+	file_ficrpc_fic_proto_depIdxs = nil
+}
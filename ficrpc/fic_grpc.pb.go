@@ -0,0 +1,270 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ficrpc/fic.proto
+
+package ficrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FicService_Program_FullMethodName       = "/ficrpc.FicService/Program"
+	FicService_WatchStatus_FullMethodName   = "/ficrpc.FicService/WatchStatus"
+	FicService_ReadRegister_FullMethodName  = "/ficrpc.FicService/ReadRegister"
+	FicService_WriteRegister_FullMethodName = "/ficrpc.FicService/WriteRegister"
+	FicService_InitFPGA_FullMethodName      = "/ficrpc.FicService/InitFPGA"
+)
+
+// FicServiceClient is the client API for FicService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FicServiceClient interface {
+	Program(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ProgramChunk, ProgramResult], error)
+	WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FicStat], error)
+	ReadRegister(ctx context.Context, in *ReadRegisterRequest, opts ...grpc.CallOption) (*RegisterValue, error)
+	WriteRegister(ctx context.Context, in *WriteRegisterRequest, opts ...grpc.CallOption) (*WriteRegisterResponse, error)
+	InitFPGA(ctx context.Context, in *InitFPGARequest, opts ...grpc.CallOption) (*InitFPGAResponse, error)
+}
+
+type ficServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFicServiceClient(cc grpc.ClientConnInterface) FicServiceClient {
+	return &ficServiceClient{cc}
+}
+
+func (c *ficServiceClient) Program(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ProgramChunk, ProgramResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FicService_ServiceDesc.Streams[0], FicService_Program_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ProgramChunk, ProgramResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FicService_ProgramClient = grpc.ClientStreamingClient[ProgramChunk, ProgramResult]
+
+func (c *ficServiceClient) WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FicStat], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FicService_ServiceDesc.Streams[1], FicService_WatchStatus_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStatusRequest, FicStat]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FicService_WatchStatusClient = grpc.ServerStreamingClient[FicStat]
+
+func (c *ficServiceClient) ReadRegister(ctx context.Context, in *ReadRegisterRequest, opts ...grpc.CallOption) (*RegisterValue, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterValue)
+	err := c.cc.Invoke(ctx, FicService_ReadRegister_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ficServiceClient) WriteRegister(ctx context.Context, in *WriteRegisterRequest, opts ...grpc.CallOption) (*WriteRegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteRegisterResponse)
+	err := c.cc.Invoke(ctx, FicService_WriteRegister_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ficServiceClient) InitFPGA(ctx context.Context, in *InitFPGARequest, opts ...grpc.CallOption) (*InitFPGAResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InitFPGAResponse)
+	err := c.cc.Invoke(ctx, FicService_InitFPGA_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FicServiceServer is the server API for FicService service.
+// All implementations must embed UnimplementedFicServiceServer
+// for forward compatibility.
+type FicServiceServer interface {
+	Program(grpc.ClientStreamingServer[ProgramChunk, ProgramResult]) error
+	WatchStatus(*WatchStatusRequest, grpc.ServerStreamingServer[FicStat]) error
+	ReadRegister(context.Context, *ReadRegisterRequest) (*RegisterValue, error)
+	WriteRegister(context.Context, *WriteRegisterRequest) (*WriteRegisterResponse, error)
+	InitFPGA(context.Context, *InitFPGARequest) (*InitFPGAResponse, error)
+	mustEmbedUnimplementedFicServiceServer()
+}
+
+// UnimplementedFicServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFicServiceServer struct{}
+
+func (UnimplementedFicServiceServer) Program(grpc.ClientStreamingServer[ProgramChunk, ProgramResult]) error {
+	return status.Errorf(codes.Unimplemented, "method Program not implemented")
+}
+func (UnimplementedFicServiceServer) WatchStatus(*WatchStatusRequest, grpc.ServerStreamingServer[FicStat]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStatus not implemented")
+}
+func (UnimplementedFicServiceServer) ReadRegister(context.Context, *ReadRegisterRequest) (*RegisterValue, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadRegister not implemented")
+}
+func (UnimplementedFicServiceServer) WriteRegister(context.Context, *WriteRegisterRequest) (*WriteRegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteRegister not implemented")
+}
+func (UnimplementedFicServiceServer) InitFPGA(context.Context, *InitFPGARequest) (*InitFPGAResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InitFPGA not implemented")
+}
+func (UnimplementedFicServiceServer) mustEmbedUnimplementedFicServiceServer() {}
+func (UnimplementedFicServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeFicServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FicServiceServer will
+// result in compilation errors.
+type UnsafeFicServiceServer interface {
+	mustEmbedUnimplementedFicServiceServer()
+}
+
+func RegisterFicServiceServer(s grpc.ServiceRegistrar, srv FicServiceServer) {
+	// If the following call pancis, it indicates UnimplementedFicServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FicService_ServiceDesc, srv)
+}
+
+func _FicService_Program_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FicServiceServer).Program(&grpc.GenericServerStream[ProgramChunk, ProgramResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FicService_ProgramServer = grpc.ClientStreamingServer[ProgramChunk, ProgramResult]
+
+func _FicService_WatchStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FicServiceServer).WatchStatus(m, &grpc.GenericServerStream[WatchStatusRequest, FicStat]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FicService_WatchStatusServer = grpc.ServerStreamingServer[FicStat]
+
+func _FicService_ReadRegister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FicServiceServer).ReadRegister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FicService_ReadRegister_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FicServiceServer).ReadRegister(ctx, req.(*ReadRegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FicService_WriteRegister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FicServiceServer).WriteRegister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FicService_WriteRegister_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FicServiceServer).WriteRegister(ctx, req.(*WriteRegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FicService_InitFPGA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InitFPGARequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FicServiceServer).InitFPGA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FicService_InitFPGA_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FicServiceServer).InitFPGA(ctx, req.(*InitFPGARequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FicService_ServiceDesc is the grpc.ServiceDesc for FicService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FicService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ficrpc.FicService",
+	HandlerType: (*FicServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReadRegister",
+			Handler:    _FicService_ReadRegister_Handler,
+		},
+		{
+			MethodName: "WriteRegister",
+			Handler:    _FicService_WriteRegister_Handler,
+		},
+		{
+			MethodName: "InitFPGA",
+			Handler:    _FicService_InitFPGA_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Program",
+			Handler:       _FicService_Program_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchStatus",
+			Handler:       _FicService_WatchStatus_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ficrpc/fic.proto",
+}
@@ -0,0 +1,219 @@
+//-----------------------------------------------------------------------------
+// ficsim.go
+// nyacom (C) 2018.05
+// Simulated FiC board on the GPIO of RPi (see gpio.Setup_sim)
+//
+// The board answers the FiC SW handshake (RREQ, RSTB, FACK, 4bit data) with
+// a 64KB register file, and the SelectMAP configuration:
+//  PROG_B low clears the FPGA, INIT rises when PROG_B is released.
+//  Data is taken on CCLK rising edge while CSI and RDWR are low, x16 if
+//  RP_CD8-15 are driven, otherwise x8.
+//  DONE rises on DESYNC after the sync word.
+//-----------------------------------------------------------------------------
+package ficsim
+
+import (
+	"fmt"
+	"sync"
+	"../selectmap"
+)
+
+//-----------------------------------------------------------------------------
+const (
+	COM_CMD_WRITE = 0x02
+	COM_CMD_READ  = 0x03
+
+	SYNC_WORD    = 0xaa995566
+	DESYNC_CMD   = 0x30008001	// Type 1 write CMD register
+	DESYNC_VALUE = 0x0000000d
+
+	REG_LINKUP = 0xfffd
+	REG_DIPSW  = 0xfffc
+	REG_CHUP   = 0xfffa
+)
+
+var PIN = selectmap.PIN
+
+// Same as PIN_COMM of ficdaemon
+var PIN_COMM = map[string] uint32 {
+	"RREQ" : PIN["RP_CD15"],
+	"RSTB" : PIN["RP_CD14"],
+	"FACK" : PIN["RP_CD12"],
+	"DATA4" : PIN["RP_CD8"],
+}
+
+//-----------------------------------------------------------------------------
+type Board struct {
+	mu     sync.Mutex
+	Regs   [0x10000]uint8
+
+	// Configuration
+	Prog   bool		// PROG_B asserted
+	Init   bool
+	Done   bool
+	Synced bool
+	Words  int		// Bytes taken after sync
+	Loads  int		// Completed configurations
+	shift  uint64		// Last 8 bytes
+	cclk   bool
+
+	// FiC SW communication
+	seq    int		// Nibble count in the transaction
+	cmd    uint8
+	addr   uint16
+	data   uint8
+	rstb   bool
+	fack   bool
+	out    uint32		// Data pins driven by the board (receive)
+}
+
+// Board with all links up
+func New() *Board {
+	b := &Board{Init: true}
+	b.Regs[REG_LINKUP] = 0xff
+	b.Regs[REG_CHUP] = 0xff
+	b.Regs[REG_DIPSW] = 0x00
+	return b
+}
+
+func bit(v uint32, pin uint32) bool {
+	return v & (1 << pin) != 0
+}
+
+//-----------------------------------------------------------------------------
+// gpio.Device
+//-----------------------------------------------------------------------------
+func (b *Board) Drive(out uint32, oe uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.drive_config(out, oe)
+	b.drive_comm(out, oe)
+}
+
+func (b *Board) Level() uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v := uint32(1 << PIN["RP_PWOK"]) | b.out
+	if b.Init {
+		v |= 1 << PIN["RP_INIT"]
+	}
+	if b.Done {
+		v |= 1 << PIN["RP_DONE"]
+	}
+	if b.fack {
+		v |= 1 << PIN_COMM["FACK"]
+	}
+	return v
+}
+
+//-----------------------------------------------------------------------------
+// SelectMAP
+//-----------------------------------------------------------------------------
+func (b *Board) drive_config(out uint32, oe uint32) {
+	// PROG_B is pulled up
+	prog := bit(oe, PIN["RP_PROG"]) && !bit(out, PIN["RP_PROG"])
+	if prog {
+		b.Init, b.Done, b.Synced, b.Words, b.shift = false, false, false, 0, 0
+	} else if b.Prog {
+		b.Init = true
+	}
+	b.Prog = prog
+
+	cclk := bit(oe, PIN["RP_CCLK"]) && bit(out, PIN["RP_CCLK"])
+	rising := cclk && !b.cclk
+	b.cclk = cclk
+	if !rising || !b.Init {
+		return
+	}
+
+	// CSI and RDWR are active low
+	if !bit(oe, PIN["RP_CSI"]) || bit(out, PIN["RP_CSI"]) || !bit(oe, PIN["RP_RDWR"]) || bit(out, PIN["RP_RDWR"]) {
+		return
+	}
+
+	word := out >> PIN["RP_CD0"]
+	b.take(uint8(word))
+	if oe & selectmap.DATA_MASK16 == selectmap.DATA_MASK16 {
+		b.take(uint8(word >> 8))
+	}
+}
+
+func (b *Board) take(v uint8) {
+	b.shift = b.shift << 8 | uint64(v)
+	if !b.Synced {
+		if uint32(b.shift) == SYNC_WORD {
+			b.Synced = true
+			b.Words = 0
+		}
+		return
+	}
+
+	b.Words++
+	if b.shift == uint64(DESYNC_CMD) << 32 | DESYNC_VALUE {
+		b.Synced = false
+		b.Done = true
+		b.Loads++
+	}
+}
+
+//-----------------------------------------------------------------------------
+// FiC SW communication
+//-----------------------------------------------------------------------------
+func (b *Board) drive_comm(out uint32, oe uint32) {
+	rreq := bit(oe, PIN_COMM["RREQ"]) && bit(out, PIN_COMM["RREQ"])
+	rstb := bit(oe, PIN_COMM["RSTB"]) && bit(out, PIN_COMM["RSTB"])
+
+	if !rreq {	// End of transaction
+		b.seq, b.rstb, b.fack, b.out = 0, false, false, 0
+		return
+	}
+
+	if rstb && !b.rstb {
+		b.nibble(uint8((out >> PIN_COMM["DATA4"]) & 0x0f))
+		b.fack = true
+	} else if !rstb && b.rstb {
+		b.fack = false
+		b.out = 0
+	}
+	b.rstb = rstb
+}
+
+// Nibble sequence: cmd, addr x4, data x2 (write) or receive x2 (read)
+func (b *Board) nibble(v uint8) {
+	switch {
+	case b.seq == 0:
+		b.cmd = v
+		b.addr = 0
+	case b.seq <= 4:
+		b.addr = b.addr << 4 | uint16(v)
+	case b.cmd == COM_CMD_WRITE && b.seq == 5:
+		b.data = v << 4
+	case b.cmd == COM_CMD_WRITE && b.seq == 6:
+		b.data |= v
+		b.Regs[b.addr] = b.data
+	case b.cmd == COM_CMD_READ && b.seq == 5:
+		b.out = uint32(b.Regs[b.addr] >> 4) << PIN_COMM["DATA4"]
+	case b.cmd == COM_CMD_READ && b.seq == 6:
+		b.out = uint32(b.Regs[b.addr] & 0x0f) << PIN_COMM["DATA4"]
+	default:
+		fmt.Printf("DEBUG: ficsim unexpected nibble %d cmd %x\n", b.seq, b.cmd)
+	}
+	b.seq++
+}
+
+//-----------------------------------------------------------------------------
+// Register access from outside the bus (e.g. link state)
+//-----------------------------------------------------------------------------
+func (b *Board) Set_reg(addr uint16, v uint8) {
+	b.mu.Lock()
+	b.Regs[addr] = v
+	b.mu.Unlock()
+}
+
+func (b *Board) Get_reg(addr uint16) uint8 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Regs[addr]
+}
@@ -0,0 +1,529 @@
+//-----------------------------------------------------------------------------
+// deploy.go
+// nyacom (C) 2018.05
+// Coordinated programming of several boards as one transaction
+//
+//  1. check     Load and check the image of every board, and that every
+//               board runs its known-good image (the rollback target)
+//  2. reserve   Reserve every board (lease), abort if one is held by others
+//  3. program   Program all boards in parallel
+//  4. barrier   Wait for DONE on all boards, and for the links among them
+//               if a topology is given
+//  5. commit    Store the images as the known-good images
+//     rollback  On any failure in 3 or 4, reprogram the known-good images
+//
+// Leases taken by the deploy are released at the end. Rollback runs also
+// when ctx is canceled, with its own timeout.
+// Programming is confirmed by the bitstream record of the daemon (sha256 and
+// programmed time), the clock of this host is not compared with the boards.
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+	"../client"
+)
+
+//-----------------------------------------------------------------------------
+const (
+	DEPLOY_TIMEOUT = 60	// sec, barrier (DONE and links)
+	DEPLOY_POLL    = 1	// sec, status poll in barrier
+	DEPLOY_LEASE   = 600	// sec
+	DEPLOY_ROLLBACK = 600	// sec, rollback of all boards
+
+	// Transaction state
+	DEPLOY_COMMITTED       = "committed"
+	DEPLOY_ABORTED         = "aborted"		// No board was programmed
+	DEPLOY_ROLLED_BACK     = "rolled_back"
+	DEPLOY_ROLLBACK_FAILED = "rollback_failed"	// Some boards are not in the known-good state
+
+	// Board stage
+	STAGE_CHECK    = "check"
+	STAGE_RESERVE  = "reserve"
+	STAGE_PROGRAM  = "program"
+	STAGE_BARRIER  = "barrier"
+	STAGE_COMMIT   = "commit"
+	STAGE_ROLLBACK = "rollback"
+)
+
+//-----------------------------------------------------------------------------
+// Deploy plan (JSON), image paths are relative to the plan file
+//  {
+//    "version": "v1.2",
+//    "mode": 16,
+//    "default": "design.bit",		Image of boards not in images
+//    "images": {"fic00": "master.bit"}
+//  }
+//-----------------------------------------------------------------------------
+type Plan struct {
+	Version string			`json:"version,omitempty"`
+	Mode    int			`json:"mode,omitempty"`
+	Default string			`json:"default,omitempty"`
+	Images  map[string]string	`json:"images,omitempty"`
+}
+
+func Load_plan(path string)(*Plan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	rel := func(f string) string {
+		if f == "" || filepath.IsAbs(f) {
+			return f
+		}
+		return filepath.Join(dir, f)
+	}
+	p.Default = rel(p.Default)
+	for b, f := range p.Images {
+		p.Images[b] = rel(f)
+	}
+
+	return &p, nil
+}
+
+// Image path of board, "" if none
+func (p *Plan) Image(board string) string {
+	if f, ok := p.Images[board]; ok {
+		return f
+	}
+	return p.Default
+}
+
+//-----------------------------------------------------------------------------
+// Transaction
+//-----------------------------------------------------------------------------
+type DeployOptions struct {
+	Topology *Topology		// Links among the boards must come up (nil: DONE only)
+	Store    *Store			// Known-good images (nil: no commit and rollback)
+	Timeout  time.Duration		// Barrier
+	Force    bool			// Deploy without the known-good image loaded
+	Log      func(format string, args ...interface{})	// Progress messages
+}
+
+type Rollback struct {
+	Sha256  string	`json:"sha256,omitempty"`
+	Version string	`json:"version,omitempty"`
+	Error   string	`json:"error,omitempty"`
+}
+
+type BoardDeploy struct {
+	Board    string		`json:"board"`
+	Image    *Image		`json:"image,omitempty"`
+	Stage    string		`json:"stage"`		// Last stage reached
+	Error    string		`json:"error,omitempty"`
+	Rollback *Rollback	`json:"rollback,omitempty"`
+
+	board    Board
+	reserved bool		// Lease taken by the deploy
+	touched  bool		// Programming was started
+}
+
+type Transaction struct {
+	Id      string		`json:"id"`
+	Version string		`json:"version,omitempty"`
+	State   string		`json:"state"`
+	Error   string		`json:"error,omitempty"`
+	Started time.Time	`json:"started"`
+	Elapsed float64		`json:"elapsed"`	// sec
+	Boards  []*BoardDeploy	`json:"boards"`
+	Links   []LinkReport	`json:"links,omitempty"`
+}
+
+func (t *Transaction) fail(stage string, err error) {
+	if t.Error == "" {
+		t.Error = stage + ": " + err.Error()
+	}
+}
+
+// Run fn on every board of the transaction in parallel, returns the first error
+func (f *Fleet) each_deploy(ctx context.Context, t *Transaction, fn func(ctx context.Context, d *BoardDeploy, c *client.Client) error) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var first error
+
+	sem := make(chan struct{}, len(t.Boards))
+	if f.Parallel > 0 {
+		sem = make(chan struct{}, f.Parallel)
+	}
+
+	for _, d := range t.Boards {
+		wg.Add(1)
+		go func(d *BoardDeploy) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem } ()
+
+			err := f.pool(d.board).Do(ctx, func(c *client.Client) error {
+				return fn(ctx, d, c)
+			})
+			if err != nil {
+				d.Error = err.Error()
+				mu.Lock()
+				if first == nil {
+					first = fmt.Errorf("%s: %v", d.Board, err)
+				}
+				mu.Unlock()
+			}
+		} (d)
+	}
+	wg.Wait()
+
+	return first
+}
+
+//-----------------------------------------------------------------------------
+// Deploy plan to the boards of the fleet
+//-----------------------------------------------------------------------------
+func (f *Fleet) Deploy(ctx context.Context, plan *Plan, opts DeployOptions)(*Transaction) {
+	log := opts.Log
+	if log == nil {
+		log = func(string, ...interface{}) {}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DEPLOY_TIMEOUT * time.Second
+	}
+	mode := plan.Mode
+	if mode == 0 {
+		mode = 16
+	}
+
+	t := &Transaction{
+		Started: time.Now(),
+		Version: plan.Version,
+	}
+	t.Id = t.Started.Format("20060102T150405.000")
+	defer func() {
+		t.Elapsed = time.Now().Sub(t.Started).Seconds()
+	} ()
+	for _, b := range f.Boards {
+		t.Boards = append(t.Boards, &BoardDeploy{Board: b.Name, Stage: STAGE_CHECK, board: b})
+	}
+
+	// 1. check
+	log("DEPLOY: %s check %d boards", t.Id, len(t.Boards))
+	for _, d := range t.Boards {
+		path := plan.Image(d.Board)
+		if path == "" {
+			d.Error = "no image in plan"
+			t.fail(STAGE_CHECK, fmt.Errorf("%s: %s", d.Board, d.Error))
+			continue
+		}
+		img, err := Load_image(path, mode)
+		if err != nil {
+			d.Error = err.Error()
+			t.fail(STAGE_CHECK, fmt.Errorf("%s: %v", d.Board, err))
+			continue
+		}
+		img.Version = plan.Version
+		d.Image = img
+	}
+	if t.Error == "" && opts.Store != nil && !opts.Force {
+		f.deploy_check_known(ctx, t, opts.Store)
+	}
+	if t.Error != "" {
+		t.State = DEPLOY_ABORTED
+		return t
+	}
+
+	// 2. reserve
+	log("DEPLOY: %s reserve", t.Id)
+	defer f.deploy_release(t)
+	err := f.each_deploy(ctx, t, func(ctx context.Context, d *BoardDeploy, c *client.Client) error {
+		d.Stage = STAGE_RESERVE
+		held, err := c.WhoContext(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := c.ReserveContext(ctx, DEPLOY_LEASE); err != nil {
+			return err
+		}
+		d.reserved = held == nil	// Keep the lease held before
+		return nil
+	})
+	if err != nil {
+		t.fail(STAGE_RESERVE, err)
+		t.State = DEPLOY_ABORTED
+		return t
+	}
+
+	// 3. program
+	log("DEPLOY: %s program", t.Id)
+	before := map[string]time.Time{}
+	var pmu sync.Mutex
+	err = f.each_deploy(ctx, t, func(ctx context.Context, d *BoardDeploy, c *client.Client) error {
+		d.Stage = STAGE_PROGRAM
+		prev, err := programmed_time(ctx, c)
+		if err != nil {
+			return err
+		}
+		pmu.Lock()
+		before[d.Board] = prev
+		pmu.Unlock()
+
+		d.touched = true
+		return c.ProgramNamedContext(ctx, bytes.NewReader(d.Image.Data), client.Mode(mode), false, filepath.Base(d.Image.Path))
+	})
+
+	// 4. barrier
+	if err == nil {
+		if opts.Topology != nil {
+			log("DEPLOY: %s barrier (DONE, links)", t.Id)
+		} else {
+			log("DEPLOY: %s barrier (DONE)", t.Id)
+		}
+		err = f.deploy_barrier(ctx, t, before, opts)
+	} else {
+		t.fail(STAGE_PROGRAM, err)
+	}
+
+	// 5. commit
+	if err == nil {
+		for _, d := range t.Boards {
+			d.Stage = STAGE_COMMIT
+			if opts.Store == nil {
+				continue
+			}
+			d.Image.Time = time.Now()
+			if err := opts.Store.Put(d.Board, d.Image); err != nil {
+				// Boards are running the new images, only the record is lost
+				d.Error = "store: " + err.Error()
+				t.fail(STAGE_COMMIT, err)
+			}
+		}
+		t.State = DEPLOY_COMMITTED
+		log("DEPLOY: %s committed", t.Id)
+		return t
+	}
+
+	// 5. rollback
+	log("DEPLOY: %s failed (%s), rollback", t.Id, t.Error)
+	if f.deploy_rollback(t, opts) {
+		t.State = DEPLOY_ROLLED_BACK
+	} else {
+		t.State = DEPLOY_ROLLBACK_FAILED
+	}
+	log("DEPLOY: %s %s", t.Id, t.State)
+	return t
+}
+
+// Every board must run its known-good image, it is reprogrammed on rollback
+func (f *Fleet) deploy_check_known(ctx context.Context, t *Transaction, store *Store) {
+	for i, r := range f.Status(ctx) {
+		d := t.Boards[i]
+		st, _ := r.Value.(*client.Status)
+		img, err := store.Get(d.Board)
+		switch {
+		case r.Err != nil:
+			d.Error = r.Err.Error()
+		case err != nil:
+			d.Error = "store: " + err.Error()
+		case img == nil:
+			d.Error = "no known-good image (force to deploy)"
+		case st.Bitstream == nil:
+			d.Error = "loaded design is unknown (force to deploy)"
+		case st.Bitstream.Sha256 != img.Sha256:
+			d.Error = fmt.Sprintf("loaded design %.12s is not the known-good image %.12s (force to deploy)", st.Bitstream.Sha256, img.Sha256)
+		default:
+			continue
+		}
+		t.fail(STAGE_CHECK, fmt.Errorf("%s: %s", d.Board, d.Error))
+	}
+}
+
+// Programmed time of the loaded design by the clock of the board (zero if unknown)
+func programmed_time(ctx context.Context, c *client.Client)(time.Time, error) {
+	st, err := c.StatusContext(ctx)
+	if err != nil || st.Bitstream == nil {
+		return time.Time{}, err
+	}
+	return st.Bitstream.Programmed, nil
+}
+
+// sha is loaded after before, and DONE is high in a status sampled since
+func loaded(st *client.Status, sha string, before time.Time) bool {
+	b := st.Bitstream
+	return b != nil && b.Sha256 == sha && b.Programmed.After(before) && !st.Ts.Before(b.Programmed) && st.Done == 1
+}
+
+// DONE on every board after programmed, and the links among the boards
+func (f *Fleet) deploy_barrier(ctx context.Context, t *Transaction, before map[string]time.Time, opts DeployOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	for {
+		res := f.Status(ctx)
+		ok := true
+		for i, r := range res {
+			d := t.Boards[i]
+			d.Stage = STAGE_BARRIER
+			st, _ := r.Value.(*client.Status)
+			if r.Err != nil || st == nil || !loaded(st, d.Image.Sha256, before[d.Board]) {
+				ok = false
+			}
+		}
+
+		var links []LinkReport
+		if opts.Topology != nil {
+			links = opts.Topology.among(res, t)
+			// Reprogramming flaps the links, only the current state counts
+			for _, l := range links {
+				ok = ok && port_up(l.PortA) && port_up(l.PortB)
+			}
+		}
+		t.Links = links
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			err := fmt.Errorf("timeout waiting for DONE and links")
+			for i, r := range res {
+				st, _ := r.Value.(*client.Status)
+				switch {
+				case r.Err != nil:
+					t.Boards[i].Error = r.Err.Error()
+				case st != nil && st.Done != 1:
+					t.Boards[i].Error = "DONE is low"
+				case st != nil && !loaded(st, t.Boards[i].Image.Sha256, before[t.Boards[i].Board]):
+					t.Boards[i].Error = "image is not loaded"
+				}
+			}
+			t.fail(STAGE_BARRIER, err)
+			return err
+		case <-time.After(DEPLOY_POLL * time.Second):
+		}
+	}
+}
+
+// Links with both ends in the transaction
+func (topo *Topology) among(res []Result, t *Transaction)([]LinkReport) {
+	in := map[string]bool{}
+	for _, d := range t.Boards {
+		in[d.Board] = true
+	}
+
+	var links []LinkReport
+	for _, l := range topo.Check(res) {
+		if l.B != nil && in[l.A.Board] && in[l.B.Board] {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// Reprogram the known-good image of the touched boards, true if all succeeded
+func (f *Fleet) deploy_rollback(t *Transaction, opts DeployOptions) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), DEPLOY_ROLLBACK * time.Second)
+	defer cancel()
+
+	ok := true
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, d := range t.Boards {
+		if !d.touched {
+			continue
+		}
+
+		d.Stage = STAGE_ROLLBACK
+		d.Rollback = &Rollback{}
+		var img *Image
+		var err error
+		if opts.Store != nil {
+			img, err = opts.Store.Get(d.Board)
+		}
+		switch {
+		case err != nil:
+			d.Rollback.Error = err.Error()
+		case img == nil:
+			d.Rollback.Error = "no known-good image"
+		}
+		if d.Rollback.Error != "" {
+			ok = false
+			continue
+		}
+		d.Rollback.Sha256, d.Rollback.Version = img.Sha256, img.Version
+
+		wg.Add(1)
+		go func(d *BoardDeploy, img *Image) {
+			defer wg.Done()
+			err := f.pool(d.board).Do(ctx, func(c *client.Client) error {
+				before, err := programmed_time(ctx, c)
+				if err != nil {
+					return err
+				}
+				if err := c.ProgramNamedContext(ctx, bytes.NewReader(img.Data), client.Mode(img.Mode), false, filepath.Base(img.Path)); err != nil {
+					return err
+				}
+				return wait_done(ctx, c, img.Sha256, before, opts.Timeout)
+			})
+			if err != nil {
+				mu.Lock()
+				d.Rollback.Error = err.Error()
+				ok = false
+				mu.Unlock()
+			}
+		} (d, img)
+	}
+	wg.Wait()
+
+	return ok
+}
+
+// Wait for DONE with sha loaded after before
+func wait_done(ctx context.Context, c *client.Client, sha string, before time.Time, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := c.StatusContext(ctx)
+		if err != nil {
+			return err
+		}
+		if loaded(st, sha, before) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for DONE")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DEPLOY_POLL * time.Second):
+		}
+	}
+}
+
+// Release the leases taken by the deploy, in parallel with a timeout per board
+func (f *Fleet) deploy_release(t *Transaction) {
+	var wg sync.WaitGroup
+	for _, d := range t.Boards {
+		if !d.reserved {
+			continue
+		}
+		wg.Add(1)
+		go func(d *BoardDeploy) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), client.DIAL_TIMEOUT * time.Second)
+			defer cancel()
+			f.pool(d.board).Do(ctx, func(c *client.Client) error {
+				return c.ReleaseContext(ctx, false)
+			})
+		} (d)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,171 @@
+//-----------------------------------------------------------------------------
+// fleet.go
+// nyacom (C) 2018.05
+// Operations on many FiC boards in parallel
+// Each board has a client.Pool, so connection errors are retried per board.
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"sync"
+	"time"
+	"bytes"
+	"context"
+	"../client"
+)
+
+//-----------------------------------------------------------------------------
+const (
+	PARALLEL = 16	// Boards operated at once
+	STALE    = 30	// sec, status older than this is reported stale
+)
+
+type Fleet struct {
+	Boards   []Board
+	Opts     client.Options	// Token is the default of boards without one
+	Parallel int
+
+	mu    sync.Mutex
+	pools map[string]*client.Pool
+}
+
+func New(boards []Board, opts client.Options)(*Fleet) {
+	return &Fleet{
+		Boards: boards,
+		Opts: opts,
+		Parallel: PARALLEL,
+		pools: map[string]*client.Pool{},
+	}
+}
+
+func (f *Fleet) pool(b Board)(*client.Pool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.pools[b.Name]
+	if !ok {
+		opts := f.Opts
+		if b.Token != "" {
+			opts.Token = b.Token
+		}
+		p = client.NewPool(b.Addr, opts)
+		f.pools[b.Name] = p
+	}
+	return p
+}
+
+func (f *Fleet) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.pools {
+		p.Close()
+	}
+	f.pools = map[string]*client.Pool{}
+}
+
+//-----------------------------------------------------------------------------
+// Per board result
+//-----------------------------------------------------------------------------
+type Result struct {
+	Board   string		`json:"board"`
+	Value   interface{}	`json:"result,omitempty"`
+	Code    string		`json:"code,omitempty"`	// Daemon error code
+	Error   string		`json:"error,omitempty"`
+	Elapsed float64		`json:"elapsed"`	// sec
+
+	Err     error		`json:"-"`
+}
+
+func (r *Result) set_err(err error) {
+	r.Err = err
+	if err == nil {
+		return
+	}
+	r.Error = err.Error()
+	if e, ok := err.(*client.Error); ok {
+		r.Code, r.Error = e.Code, e.Msg
+	}
+}
+
+// Results of failed boards
+func Failed(res []Result)([]Result) {
+	var failed []Result
+	for _, r := range res {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// fn is retried on connection error only until it sent a request
+type BoardFunc func(ctx context.Context, b Board, c *client.Client)(interface{}, error)
+
+// Run fn on each board, at most Parallel at once, results in board order
+func (f *Fleet) Each(ctx context.Context, fn BoardFunc)([]Result) {
+	return f.each(ctx, fn, false)
+}
+
+// As Each, fn is idempotent and may be called more than once
+func (f *Fleet) EachIdempotent(ctx context.Context, fn BoardFunc)([]Result) {
+	return f.each(ctx, fn, true)
+}
+
+func (f *Fleet) each(ctx context.Context, fn BoardFunc, idempotent bool)([]Result) {
+	res := make([]Result, len(f.Boards))
+	n := f.Parallel
+	if n <= 0 {
+		n = len(f.Boards)
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+
+	for i, b := range f.Boards {
+		wg.Add(1)
+		go func(r *Result, b Board) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem } ()
+
+			r.Board = b.Name
+			t1 := time.Now()
+			do := f.pool(b).Do
+			if idempotent {
+				do = f.pool(b).DoIdempotent
+			}
+			err := do(ctx, func(c *client.Client) (err error) {
+				r.Value, err = fn(ctx, b, c)
+				return err
+			})
+			r.Elapsed = time.Now().Sub(t1).Seconds()
+			r.set_err(err)
+		} (&res[i], b)
+	}
+	wg.Wait()
+
+	return res
+}
+
+//-----------------------------------------------------------------------------
+// Status and programming
+//-----------------------------------------------------------------------------
+// Value is *client.Status
+func (f *Fleet) Status(ctx context.Context)([]Result) {
+	return f.EachIdempotent(ctx, func(ctx context.Context, b Board, c *client.Client)(interface{}, error) {
+		return c.StatusContext(ctx)
+	})
+}
+
+type ProgResult struct {
+	Size int	`json:"size"`
+}
+
+// Program bin to every board
+func (f *Fleet) Program(ctx context.Context, bin []byte, mode client.Mode, pr bool)([]Result) {
+	return f.Each(ctx, func(ctx context.Context, b Board, c *client.Client)(interface{}, error) {
+		if err := c.ProgramContext(ctx, bytes.NewReader(bin), mode, pr); err != nil {
+			return nil, err
+		}
+		return ProgResult{Size: len(bin)}, nil
+	})
+}
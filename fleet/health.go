@@ -0,0 +1,61 @@
+//-----------------------------------------------------------------------------
+// health.go
+// nyacom (C) 2018.05
+// Cluster health summary from board status
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"time"
+	"math/bits"
+	"../client"
+)
+
+type Health struct {
+	Ok          bool	`json:"ok"`		// All boards reachable, powered and configured
+	Boards      int		`json:"boards"`
+	Reachable   int		`json:"reachable"`
+	PowerOk     int		`json:"power_ok"`
+	Done        int		`json:"done"`
+	LinksUp     int		`json:"links_up"`	// LINKUP bits over all boards
+	ChannelsUp  int		`json:"channels_up"`	// CHUP bits over all boards
+
+	Unreachable []string	`json:"unreachable,omitempty"`
+	PowerFail   []string	`json:"power_fail,omitempty"`
+	NotDone     []string	`json:"not_done,omitempty"`
+	Stale       []string	`json:"stale,omitempty"`	// Status older than STALE
+}
+
+// res is the result of Fleet.Status
+func Summarize(res []Result)(Health) {
+	h := Health{Boards: len(res)}
+
+	for _, r := range res {
+		st, _ := r.Value.(*client.Status)
+		if r.Err != nil || st == nil {
+			h.Unreachable = append(h.Unreachable, r.Board)
+			continue
+		}
+		h.Reachable++
+
+		if st.Pwr == 1 {
+			h.PowerOk++
+		} else {
+			h.PowerFail = append(h.PowerFail, r.Board)
+		}
+		if st.Done == 1 {
+			h.Done++
+		} else {
+			h.NotDone = append(h.NotDone, r.Board)
+		}
+		if time.Now().Sub(st.Ts).Seconds() > STALE {
+			h.Stale = append(h.Stale, r.Board)
+		}
+
+		h.LinksUp += bits.OnesCount8(st.Linkup)
+		h.ChannelsUp += bits.OnesCount8(st.Chup)
+	}
+
+	h.Ok = h.Reachable == h.Boards && h.PowerOk == h.Boards && h.Done == h.Boards && len(h.Stale) == 0
+	return h
+}
@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------
+// inventory.go
+// nyacom (C) 2018.05
+// Inventory of FiC boards (one ficdaemon per board)
+//
+// Inventory file (JSON)
+//  {
+//    "token": "...",		Default auth token
+//    "tls": false,		Use TLS
+//    "tls_ca": "ca.pem",		CA bundle to verify the daemons (implies tls)
+//    "boards": [
+//      {"name": "fic00", "addr": "fic00:4000", "tags": ["ring0"]},
+//      {"name": "fic01", "addr": "fic01", "tags": ["ring0"], "token": "..."}
+//    ]
+//  }
+//
+// Selector is a comma separated list of board names, "tag:TAG" and "all"
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"fmt"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+type Board struct {
+	Name  string	`json:"name"`
+	Addr  string	`json:"addr"`		// host[:port]
+	Tags  []string	`json:"tags,omitempty"`
+	Token string	`json:"token,omitempty"`	// Overrides the inventory token
+}
+
+type Inventory struct {
+	Token  string	`json:"token,omitempty"`
+	TLS    bool	`json:"tls,omitempty"`
+	TLSCA  string	`json:"tls_ca,omitempty"`
+	Boards []Board	`json:"boards"`
+}
+
+func Load(path string)(*Inventory, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv Inventory
+	if err := json.Unmarshal(b, &inv); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range inv.Boards {
+		b := &inv.Boards[i]
+		if b.Addr == "" {
+			return nil, fmt.Errorf("%s: board %d has no addr", path, i)
+		}
+		if b.Name == "" {
+			b.Name = b.Addr
+		}
+		if names[b.Name] {
+			return nil, fmt.Errorf("%s: duplicate board %s", path, b.Name)
+		}
+		names[b.Name] = true
+	}
+
+	return &inv, nil
+}
+
+// Inventory of addresses (e.g. from the command line), named by address
+func Adhoc(addrs []string)(*Inventory) {
+	inv := &Inventory{}
+	for _, a := range addrs {
+		inv.Boards = append(inv.Boards, Board{Name: a, Addr: a})
+	}
+	return inv
+}
+
+func (b Board) Has_tag(tag string) bool {
+	for _, t := range b.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Boards matching sel in inventory order
+func (inv *Inventory) Select(sel string)([]Board, error) {
+	match := make([]bool, len(inv.Boards))
+
+	for _, s := range strings.Split(sel, ",") {
+		s = strings.TrimSpace(s)
+		found := false
+		for i, b := range inv.Boards {
+			switch {
+			case s == "all":
+			case strings.HasPrefix(s, "tag:"):
+				if !b.Has_tag(strings.TrimPrefix(s, "tag:")) {
+					continue
+				}
+			case s != b.Name:
+				continue
+			}
+			match[i] = true
+			found = true
+		}
+		if !found && s != "" {
+			return nil, fmt.Errorf("no board matches %q", s)
+		}
+	}
+
+	var boards []Board
+	for i, b := range inv.Boards {
+		if match[i] {
+			boards = append(boards, b)
+		}
+	}
+	return boards, nil
+}
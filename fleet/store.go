@@ -0,0 +1,139 @@
+//-----------------------------------------------------------------------------
+// store.go
+// nyacom (C) 2018.05
+// Bitstream images, and the known-good image of each board
+// The store keeps the image of the last committed deploy per board as
+// DIR/BOARD.img (the file as loaded, .bit or .bin) with its metadata in
+// DIR/BOARD.json. Both are replaced by rename, the metadata last, and the
+// image is checked against the sha256 of the metadata when read.
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"../selectmap"
+)
+
+type Image struct {
+	Path    string		`json:"path,omitempty"`
+	Design  string		`json:"design,omitempty"`	// .bit header
+	Sha256  string		`json:"sha256"`		// Of the .bin data
+	Size    int		`json:"size"`
+	Version string		`json:"version,omitempty"`
+	Mode    int		`json:"mode"`		// SelectMAP width
+	Time    time.Time	`json:"time,omitempty"`	// Committed (store)
+
+	Data    []byte		`json:"-"`	// As loaded, sent to the daemon
+}
+
+// Load .bit or .bin and check the sync word for width
+// The .bit file is kept as is, the daemon records its header.
+func Load_image(path string, width int)(*Image, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bin, info, err := image_bin(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := selectmap.Check(bin, width); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Path: path,
+		Design: info.Design,
+		Sha256: bin_sha256(bin),
+		Size: len(bin),
+		Mode: width,
+		Data: data,
+	}, nil
+}
+
+// Configuration data of .bit or .bin
+func image_bin(data []byte)([]byte, selectmap.BitInfo, error) {
+	if !selectmap.Is_bit(data) {
+		return data, selectmap.BitInfo{}, nil
+	}
+	return selectmap.Parse_bit(data)
+}
+
+// Same hash as the bitstream record of the daemon
+func bin_sha256(bin []byte) string {
+	sum := sha256.Sum256(bin)
+	return hex.EncodeToString(sum[:])
+}
+
+//-----------------------------------------------------------------------------
+type Store struct {
+	Dir string
+}
+
+func (s *Store) path(board string, ext string) string {
+	name := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(board)
+	return filepath.Join(s.Dir, name + ext)
+}
+
+// Known-good image of board, nil if none
+func (s *Store) Get(board string)(*Image, error) {
+	meta, err := ioutil.ReadFile(s.path(board, ".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var img Image
+	if err := json.Unmarshal(meta, &img); err != nil {
+		return nil, err
+	}
+	if img.Data, err = ioutil.ReadFile(s.path(board, ".img")); err != nil {
+		return nil, err
+	}
+
+	// Image and metadata of different Puts (interrupted)
+	bin, _, err := image_bin(img.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.path(board, ".img"), err)
+	}
+	if sha := bin_sha256(bin); sha != img.Sha256 {
+		return nil, fmt.Errorf("%s: sha256 %.12s does not match the metadata %.12s", s.path(board, ".img"), sha, img.Sha256)
+	}
+	return &img, nil
+}
+
+// Replace the known-good image of board (data first, then metadata)
+// The image of an interrupted Put is detected by Get.
+func (s *Store) Put(board string, img *Image) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(img, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := write_file(s.path(board, ".img"), img.Data); err != nil {
+		return err
+	}
+	return write_file(s.path(board, ".json"), meta)
+}
+
+// Write through a temporary file and rename
+func write_file(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,202 @@
+//-----------------------------------------------------------------------------
+// topology.go
+// nyacom (C) 2018.05
+// Check the cabling of the cluster against the observed link state
+//
+// Topology descriptor (JSON)
+//  {"links": [
+//    {"a": {"board": "fic00", "port": 0}, "b": {"board": "fic01", "port": 1}},
+//    ...
+//  ]}
+//
+// A port is up when both LINKUP and CHUP bits are set. A link is "up" when
+// both ends are up, "half" when only one is, "down" when none is. Ports
+// which are linked but not in the descriptor are reported "unexpected".
+//-----------------------------------------------------------------------------
+package fleet
+
+import (
+	"fmt"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+	"../client"
+)
+
+const (
+	PORTS = 8	// Ports per board (bits of LINKUP and CHUP)
+
+	LINK_UP         = "up"
+	LINK_DOWN       = "down"
+	LINK_HALF       = "half"
+	LINK_FLAPPING   = "flapping"
+	LINK_UNKNOWN    = "unknown"		// Board status not available
+	LINK_UNEXPECTED = "unexpected"		// Linked port not in the descriptor
+)
+
+type End struct {
+	Board string	`json:"board"`
+	Port  int	`json:"port"`
+}
+
+func (e End) String() string {
+	return fmt.Sprintf("%s:%d", e.Board, e.Port)
+}
+
+type Link struct {
+	A End	`json:"a"`
+	B End	`json:"b"`
+}
+
+type Topology struct {
+	Links []Link	`json:"links"`
+}
+
+func Load_topology(path string)(*Topology, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Topology
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	used := map[End]bool{}
+	for _, l := range t.Links {
+		for _, e := range []End{l.A, l.B} {
+			if e.Board == "" || e.Port < 0 || e.Port >= PORTS {
+				return nil, fmt.Errorf("%s: invalid link end %s", path, e)
+			}
+			if used[e] {
+				return nil, fmt.Errorf("%s: %s is used twice", path, e)
+			}
+			used[e] = true
+		}
+	}
+
+	return &t, nil
+}
+
+// Boards referenced by the descriptor
+func (t *Topology) Boards()([]string) {
+	var names []string
+	seen := map[string]bool{}
+	for _, l := range t.Links {
+		for _, n := range []string{l.A.Board, l.B.Board} {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+//-----------------------------------------------------------------------------
+// Check
+//-----------------------------------------------------------------------------
+type LinkReport struct {
+	A     End		`json:"a"`
+	B     *End		`json:"b,omitempty"`	// nil for unexpected
+	State string		`json:"state"`
+	Msg   string		`json:"msg,omitempty"`
+	PortA *client.Port	`json:"port_a,omitempty"`
+	PortB *client.Port	`json:"port_b,omitempty"`
+}
+
+func (r LinkReport) Ok() bool {
+	return r.State == LINK_UP
+}
+
+func port_up(p *client.Port) bool {
+	return p != nil && p.Link && p.Chup
+}
+
+func port_msg(e End, p *client.Port) string {
+	switch {
+	case p == nil:
+		return e.String() + " no status"
+	case p.Link && !p.Chup:
+		return e.String() + " linked, channel down"
+	case !p.Link && p.Chup:
+		return e.String() + " channel up without link"
+	case !p.Link:
+		return e.String() + " no link"
+	}
+	return ""
+}
+
+// res is the result of Fleet.Status, the boards are matched by name
+func (t *Topology) Check(res []Result)([]LinkReport) {
+	status := map[string]*client.Status{}
+	for _, r := range res {
+		if st, ok := r.Value.(*client.Status); ok && r.Err == nil {
+			status[r.Board] = st
+		}
+	}
+	port := func(e End)(*client.Port) {
+		st, ok := status[e.Board]
+		if !ok {
+			return nil
+		}
+		p := st.Port(e.Port)
+		return &p
+	}
+
+	var reports []LinkReport
+	described := map[End]bool{}
+
+	for _, l := range t.Links {
+		b := l.B
+		described[l.A], described[l.B] = true, true
+		r := LinkReport{A: l.A, B: &b, PortA: port(l.A), PortB: port(l.B)}
+
+		up_a, up_b := port_up(r.PortA), port_up(r.PortB)
+		switch {
+		case r.PortA == nil || r.PortB == nil:
+			r.State = LINK_UNKNOWN
+		case r.PortA.Flapping || r.PortB.Flapping:
+			r.State = LINK_FLAPPING
+		case up_a && up_b:
+			r.State = LINK_UP
+		case up_a || up_b:
+			r.State = LINK_HALF
+		default:
+			r.State = LINK_DOWN
+		}
+
+		if r.State != LINK_UP {
+			var msgs []string
+			for _, m := range []string{port_msg(l.A, r.PortA), port_msg(l.B, r.PortB)} {
+				if m != "" {
+					msgs = append(msgs, m)
+				}
+			}
+			if r.State == LINK_FLAPPING {
+				msgs = append(msgs, fmt.Sprintf("changes %d/%d", r.PortA.Changes, r.PortB.Changes))
+			}
+			r.Msg = strings.Join(msgs, ", ")
+		}
+		reports = append(reports, r)
+	}
+
+	// Linked ports not in the descriptor (e.g. miscabled)
+	for _, r := range res {
+		st, ok := status[r.Board]
+		if !ok {
+			continue
+		}
+		for i := 0; i < PORTS; i++ {
+			e := End{Board: r.Board, Port: i}
+			p := st.Port(i)
+			if described[e] || !p.Link {
+				continue
+			}
+			reports = append(reports, LinkReport{A: e, State: LINK_UNEXPECTED, Msg: "linked port is not in topology", PortA: &p})
+		}
+	}
+
+	return reports
+}
@@ -0,0 +1,297 @@
+//-----------------------------------------------------------------------------
+// frame.go
+// nyacom (C) 2018.05
+// Length-prefixed framed protocol
+//
+// Frame layout (big endian)
+//  len     uint32  Length of type + id + payload
+//  type    uint8   FRAME_HELLO, FRAME_REQ, FRAME_RESP, FRAME_ERR,
+//                  FRAME_CANCEL, FRAME_QUEUED
+//  id      uint32  Request ID (echoed in the response)
+//  payload
+//
+// The client sends FRAME_MAGIC right after the first "OK\r\n" prompt,
+// then FRAME_HELLO with its version. The daemon replies FRAME_HELLO with
+// its own version and DAEMON_VERSION, or FRAME_ERR on mismatch.
+//
+// Requests are executed in order while the daemon keeps reading, so a
+// client may send FRAME_CANCEL with the ID of a pending request. A request
+// waiting for the hardware queue is notified with FRAME_QUEUED.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"io"
+	"net"
+	"bufio"
+	"strings"
+	"encoding/binary"
+)
+
+type Frame struct {
+	Type    uint8
+	Id      uint32
+	Payload []byte
+}
+
+// Payloads over FRAME_SMALLSIZE are read only when large(f, head) accepts
+// them, head is the first FRAME_SMALLSIZE bytes (the request command).
+// The size comes from the peer, so nothing large is allocated before that.
+func frame_read(r io.Reader, large func(f Frame, head []byte) error)(f Frame, err error) {
+	hdr := make([]byte, FRAME_HDRSIZE)
+	if _, err = io.ReadFull(r, hdr); err != nil {
+		return f, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	if size < FRAME_HDRSIZE - 4 || size > FRAME_MAXSIZE {
+		return f, fic_error(ERR_BAD_FRAME, "Frame size out of range")
+	}
+
+	f.Type = hdr[4]
+	f.Id = binary.BigEndian.Uint32(hdr[5:9])
+	n := int(size) - (FRAME_HDRSIZE - 4)
+
+	if n <= FRAME_SMALLSIZE {
+		f.Payload = make([]byte, n)
+		if _, err = io.ReadFull(r, f.Payload); err != nil {
+			return f, err
+		}
+		return f, nil
+	}
+
+	head := make([]byte, FRAME_SMALLSIZE)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return f, err
+	}
+	if large == nil {
+		return f, fic_errorf(ERR_BAD_FRAME, "Frame too large (%d B)", n)
+	}
+	if err = large(f, head); err != nil {
+		return f, err
+	}
+
+	f.Payload = make([]byte, n)
+	copy(f.Payload, head)
+	if _, err = io.ReadFull(r, f.Payload[len(head):]); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func frame_write(w io.Writer, f Frame) error {
+	buf := make([]byte, FRAME_HDRSIZE, FRAME_HDRSIZE + len(f.Payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(FRAME_HDRSIZE - 4 + len(f.Payload)))
+	buf[4] = f.Type
+	binary.BigEndian.PutUint32(buf[5:9], f.Id)
+	buf = append(buf, f.Payload...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func frame_write_err(w io.Writer, id uint32, err error) error {
+	fe := fic_error_of(err)
+	msg := fe.Error()
+	payload := make([]byte, 2, 2 + len(msg))
+	binary.BigEndian.PutUint16(payload, fe.Num())
+	payload = append(payload, msg...)
+
+	return frame_write(w, Frame{Type: FRAME_ERR, Id: id, Payload: payload})
+}
+
+// Split FRAME_REQ payload into command fields and binary data
+func frame_parse_req(payload []byte)(b []string, data []byte, err error) {
+	if len(payload) < 2 {
+		return nil, nil, fic_error(ERR_BAD_FRAME, "Request too short")
+	}
+
+	cmdlen := int(binary.BigEndian.Uint16(payload[0:2]))
+	if len(payload) < 2 + cmdlen {
+		return nil, nil, fic_error(ERR_BAD_FRAME, "Request command truncated")
+	}
+
+	b = strings.Fields(string(payload[2:2+cmdlen]))
+	if len(b) == 0 {
+		return nil, nil, fic_error(ERR_BAD_ARGS, "Request command empty")
+	}
+
+	return b, payload[2+cmdlen:], nil
+}
+
+//-----------------------------------------------------------------------------
+// Framed protocol connection
+//-----------------------------------------------------------------------------
+// Queued request with its own cancelable context
+type FrameReq struct {
+	f      Frame
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func monitor_frame_conn(conn net.Conn, r *bufio.Reader, s *Session, mon *FicStat) {
+	var (
+		wmu     sync.Mutex
+		pmu     sync.Mutex
+		pending = map[uint32]context.CancelFunc{}	// Cancel handles by request ID
+		reqs    = make(chan FrameReq, FRAME_PIPELINE)
+		done    = make(chan struct{})
+	)
+
+	send := func(f Frame) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		frame_write(conn, f)
+	}
+	send_err := func(id uint32, err error) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		frame_write_err(conn, id, err)
+	}
+
+	// Authentication result for the reader (s is updated by the worker)
+	authed := Session{Identity: s.Identity, Role: s.Role}
+
+	// Worker: requests are executed in arrival order, the reader keeps
+	// accepting FRAME_CANCEL meanwhile
+	go func() {
+		defer close(done)
+		for q := range reqs {
+			resp, err := monitor_frame_exec(q, s, mon, send)
+
+			pmu.Lock()
+			delete(pending, q.f.Id)
+			authed.Identity, authed.Role = s.Identity, s.Role
+			pmu.Unlock()
+			q.cancel()
+
+			if err != nil {
+				send_err(q.f.Id, err)
+				continue
+			}
+			send(Frame{Type: FRAME_RESP, Id: q.f.Id, Payload: resp})
+		}
+	} ()
+
+	defer func() {
+		s.Close()	// Cancel queued operations
+		close(reqs)
+		<-done
+	} ()
+
+	hello := false
+
+	// Large frames are only PROG data of an authorized session
+	large := func(f Frame, head []byte) error {
+		if !hello || f.Type != FRAME_REQ {
+			return fic_error(ERR_BAD_FRAME, "Frame too large")
+		}
+		b, _, err := frame_parse_req(head)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case TERM_CMD_PROG, TERM_CMD_PROG8, TERM_CMD_PROG_PR, TERM_CMD_PROG8_PR:
+		default:
+			return fic_error(ERR_BAD_FRAME, "Frame too large for " + b[0])
+		}
+
+		pmu.Lock()
+		as := authed
+		pmu.Unlock()
+		return auth_check(&as, b[0])
+	}
+
+	for {
+		f, err := frame_read(r, large)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("DEBUG: FRAME READ ERROR", err)
+				if _, ok := err.(*FicError); !ok {
+					err = fic_error(ERR_BAD_FRAME, err.Error())
+				}
+				send_err(f.Id, err)
+			}
+			return
+		}
+
+		switch f.Type {
+		// Version handshake
+		case FRAME_HELLO:
+			if len(f.Payload) < 2 {
+				send_err(f.Id, fic_error(ERR_BAD_FRAME, "HELLO too short"))
+				continue
+			}
+			ver := binary.BigEndian.Uint16(f.Payload[0:2])
+			if ver != FRAME_VERSION {
+				send_err(f.Id, fic_errorf(ERR_VERSION_MISMATCH,
+					"Unsupported version %d (daemon %d)", ver, FRAME_VERSION))
+				continue
+			}
+			hello = true
+
+			payload := make([]byte, 2)
+			binary.BigEndian.PutUint16(payload, FRAME_VERSION)
+			payload = append(payload, DAEMON_VERSION...)
+			send(Frame{Type: FRAME_HELLO, Id: f.Id, Payload: payload})
+
+		// Command request
+		case FRAME_REQ:
+			if !hello {
+				send_err(f.Id, fic_error(ERR_NO_HELLO, "HELLO required"))
+				continue
+			}
+
+			ctx, cancel := context.WithCancel(s.Ctx)
+			pmu.Lock()
+			pending[f.Id] = cancel
+			pmu.Unlock()
+			reqs <- FrameReq{f: f, ctx: ctx, cancel: cancel}
+
+		// Cancel a queued or waiting request (id = target request)
+		case FRAME_CANCEL:
+			pmu.Lock()
+			cancel, ok := pending[f.Id]
+			pmu.Unlock()
+			if ok {
+				fmt.Println("DEBUG: FRAME CANCEL", f.Id)
+				cancel()
+			}
+
+		default:
+			send_err(f.Id, fic_errorf(ERR_BAD_FRAME,
+				"Unknown frame type %d", f.Type))
+		}
+	}
+}
+
+func monitor_frame_exec(q FrameReq, s *Session, mon *FicStat, send func(Frame))(resp []byte, err error) {
+	b, data, err := frame_parse_req(q.f.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.ctx.Err() != nil {
+		return nil, fic_error(ERR_CANCELED, b[0] + " canceled")
+	}
+
+	// Per request context and queue position notification
+	rs := *s
+	rs.Ctx = q.ctx
+	rs.Queued = func(pos int) {
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, uint32(pos))
+		send(Frame{Type: FRAME_QUEUED, Id: q.f.Id, Payload: payload})
+	}
+
+	resp, err = monitor_exec(&rs, b, data, mon)
+	s.Identity, s.Role = rs.Identity, rs.Role	// Keep AUTH result
+
+	if err != nil {
+		fmt.Println("DEBUG:", b[0], "ERROR", err)
+	}
+	return resp, err
+}
@@ -11,6 +11,9 @@ import (
 	"reflect"
 	"syscall"
 	"runtime"
+	"context"
+	"strings"
+	"path/filepath"
 )
 
 //-----------------------------------------------------------------------------
@@ -18,11 +21,17 @@ const (
 	LOCKFILE                = "/tmp/gpio.lock"
 	LOCKTIMEOUT             = 120
 	LOCKEXPIRE              = 300
+	LOCKPOLL                = 10	// msec
 	BCM2708_PERI_BASE	= 0x3F000000
 	GPIO_BASE		= (BCM2708_PERI_BASE + 0x200000)
 	BLOCK_SIZE		= (4 * 1024)
 )
 
+var (
+	ErrLockTimeout  = errors.New("gpio lock timeout")
+	ErrLockCanceled = errors.New("gpio lock canceled")
+)
+
 var (
 	mem32 []uint32
 	mem8 []byte
@@ -69,50 +78,159 @@ func Setup() (err error){
 }
 
 func Close() {
+	if sim_dev != nil {
+		return
+	}
 	syscall.Munmap(mem8)
 }
 
 //-----------------------------------------------------------------------------
-func Gpio_lock()(error) {
-	pc, file, line, _ := runtime.Caller(1)
+// GPIO lock
+// Note: Goroutines are serialized by lock_sem, processes by flock(2) on
+//       LOCKFILE. The descriptor is held while locked, so the kernel
+//       releases the lock if the holder dies. The file is never removed.
+//       Holder metadata "pid op since" is written into LOCKFILE.
+//-----------------------------------------------------------------------------
+type Holder struct {
+	Pid   int
+	Op    string
+	Since time.Time
+}
 
-	t1 := time.Now()
-	for stat, err := os.Stat(LOCKFILE); !os.IsNotExist(err); {
-		// Check if the lockfile is too old -> bug?
-		if (time.Now().Sub(stat.ModTime())).Seconds() > LOCKEXPIRE {
-			//break
-		}
+var (
+	lock_sem = make(chan struct{}, 1)	// In-process mutex
+	lock_fd  = -1				// Held flock descriptor
+	lock_op  string
+)
 
-		t2 := time.Now()
-		if (t2.Sub(t1)).Seconds() > LOCKTIMEOUT {
-			return errors.New("gpio lock timeout")
+// Current lock holder from LOCKFILE (Pid == 0 if free)
+func Lock_holder()(h Holder, err error) {
+	b, err := os.ReadFile(LOCKFILE)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
 		}
+		return h, err
+	}
 
-		time.Sleep(1 * time.Second)
-		fmt.Println("DEBUG: GPIO_LOCK at ", pc, file, line, "is waiting")
-		stat, err = os.Stat(LOCKFILE)
+	var since int64
+	if n, _ := fmt.Sscanf(string(b), "%d %s %d", &h.Pid, &h.Op, &since); n < 3 {
+		return Holder{}, nil
 	}
+	h.Since = time.Unix(0, since)
+	return h, nil
+}
+
+// Holder process is gone but its metadata is left (lock itself is free)
+func (h Holder) Stale() bool {
+	if h.Pid == 0 {
+		return false
+	}
+	err := syscall.Kill(h.Pid, 0)
+	return err == syscall.ESRCH
+}
 
-	fd, _ := syscall.Open(LOCKFILE, syscall.O_CREAT | syscall.O_RDONLY, 0666)
-	defer syscall.Close(fd)
+func Gpio_lock_ctx(ctx context.Context, op string)(error) {
+	op = strings.Join(strings.Fields(op), "_")
+	if op == "" {
+		op = "-"
+	}
+
+	// In-process
+	select {
+	case lock_sem <- struct{}{}:
+	case <-ctx.Done():
+		return lock_ctx_err(ctx)
+	}
 
-	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+	// Inter-process
+	fd, err := syscall.Open(LOCKFILE, syscall.O_CREAT | syscall.O_RDWR | syscall.O_CLOEXEC, 0666)
+	if err != nil {
+		<-lock_sem
 		return err
 	}
 
-	fmt.Println("DEBUG: GPIO_LOCK at ", pc, file, line)
+	t1 := time.Now()
+	warned := false
+	for {
+		err = syscall.Flock(fd, syscall.LOCK_EX | syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			syscall.Close(fd)
+			<-lock_sem
+			return err
+		}
+
+		// Another process holds the lock
+		if !warned && time.Now().Sub(t1).Seconds() > 1 {
+			h, _ := Lock_holder()
+			fmt.Println("DEBUG: GPIO_LOCK", op, "is waiting for pid", h.Pid, h.Op, "since", h.Since)
+			if time.Now().Sub(h.Since).Seconds() > LOCKEXPIRE {
+				// Holder is alive (flock is kept), breaking the lock is unsafe
+				fmt.Println("WARNING: GPIO_LOCK held by pid", h.Pid, "over", LOCKEXPIRE, "sec")
+			}
+			warned = true
+		}
+
+		select {
+		case <-time.After(LOCKPOLL * time.Millisecond):
+		case <-ctx.Done():
+			syscall.Close(fd)
+			<-lock_sem
+			return lock_ctx_err(ctx)
+		}
+	}
+
+	// Recover metadata left by a dead holder
+	if h, _ := Lock_holder(); h.Stale() {
+		fmt.Println("DEBUG: GPIO_LOCK recovered stale lock of pid", h.Pid, h.Op)
+	}
+
+	syscall.Ftruncate(fd, 0)
+	syscall.Pwrite(fd, []byte(fmt.Sprintf("%d %s %d\n", os.Getpid(), op, time.Now().UnixNano())), 0)
+
+	lock_fd = fd
+	lock_op = op
+	fmt.Println("DEBUG: GPIO_LOCK at ", op)
 
 	return nil
 }
 
+func lock_ctx_err(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrLockTimeout
+	}
+	return ErrLockCanceled
+}
+
+// Lock with LOCKTIMEOUT, op is the caller
+func Gpio_lock()(error) {
+	_, file, line, _ := runtime.Caller(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), LOCKTIMEOUT * time.Second)
+	defer cancel()
+
+	return Gpio_lock_ctx(ctx, fmt.Sprintf("%s:%d", filepath.Base(file), line))
+}
+
 func Gpio_unlock()(error) {
-	pc, file, line, _ := runtime.Caller(1)
+	if lock_fd < 0 {
+		return errors.New("gpio unlock failed (not locked)")
+	}
+
+	syscall.Ftruncate(lock_fd, 0)
+	err := syscall.Flock(lock_fd, syscall.LOCK_UN)
+	syscall.Close(lock_fd)
+	lock_fd = -1
 
-	if err := os.Remove(LOCKFILE); err != nil {
+	fmt.Println("DEBUG: GPIO_UNLOCK at ", lock_op)
+	<-lock_sem
+
+	if err != nil {
 		return errors.New("gpio unlock failed")
 	}
-
-	fmt.Println("DEBUG: GPIO_UNLOCK at ", pc, file, line)
 	return nil
 }
 
@@ -121,38 +239,58 @@ func Set_all_input() {
 	mem32[0] = 0x00	// GPFSEL0
 	mem32[1] = 0x00	// GPFSEL1
 	mem32[2] = 0x00 // GPFSEL2
+	if sim_dev != nil {
+		sim_fsel()
+	}
 }
 
 func Set_input(pin uint32) {
 	mem32[(pin/10)] &= ^(7 << ((pin % 10) * 3))
+	if sim_dev != nil {
+		sim_fsel()
+	}
 }
 
 func Set_output(pin uint32) {
 	Set_input(pin)
 	mem32[(pin/10)] |= (1 << ((pin % 10) * 3))
+	if sim_dev != nil {
+		sim_fsel()
+	}
 }
 //-----------------------------------------------------------------------------
 func Set_pin(pin uint32) {
-	mem32[7] = Get_bus() | (1 << pin)
+	Set_bus(Get_bus() | (1 << pin))
 }
 
 func Clr_pin(pin uint32) {
-	mem32[10] = Get_bus() | (1 << pin)
+	Clr_bus(Get_bus() | (1 << pin))
 }
 
 func Set_bus(v uint32) {
+	if sim_dev != nil {
+		sim_write(v, 0)
+		return
+	}
 	mem32[7] = v
 }
 
 func Clr_bus(v uint32) {
+	if sim_dev != nil {
+		sim_write(0, v)
+		return
+	}
 	mem32[10] = v
 }
 
 func Get_pin(pin uint32) uint32 {
-	return (mem32[13] & (1 << pin)) >> pin
+	return (Get_bus() & (1 << pin)) >> pin
 }
 
 func Get_bus() uint32 {
+	if sim_dev != nil {
+		return sim_level()
+	}
 	return mem32[13]
 }
 
@@ -0,0 +1,69 @@
+package gpio
+
+import (
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+// Simulated GPIO (no /dev/gpiomem)
+// Note: GPFSEL registers are plain memory. Pins in output mode are driven by
+//       the output latch (GPSET/GPCLR), other pins by the simulated Device.
+//-----------------------------------------------------------------------------
+type Device interface {
+	// Called on every change of the RPi side, out is the latch of the
+	// pins in output mode (oe)
+	Drive(out uint32, oe uint32)
+
+	// Pin levels driven by the device
+	Level() uint32
+}
+
+var (
+	sim_dev   Device
+	sim_mu    sync.Mutex
+	sim_latch uint32
+	sim_oe    uint32
+)
+
+// Use dev instead of the GPIO of RPi, called instead of Setup
+func Setup_sim(dev Device) error {
+	mem32 = make([]uint32, BLOCK_SIZE / 4)
+	sim_dev = dev
+	sim_latch = 0
+	sim_fsel()
+	return nil
+}
+
+func Is_sim() bool {
+	return sim_dev != nil
+}
+
+// Output enable from GPFSEL0-2 (pin 0-29)
+func sim_fsel() {
+	sim_mu.Lock()
+	defer sim_mu.Unlock()
+
+	var oe uint32
+	for pin := uint32(0); pin < 30; pin++ {
+		if (mem32[pin/10] >> ((pin % 10) * 3)) & 7 == 1 {
+			oe |= 1 << pin
+		}
+	}
+	sim_oe = oe
+	sim_dev.Drive(sim_latch & oe, oe)
+}
+
+func sim_write(set uint32, clr uint32) {
+	sim_mu.Lock()
+	defer sim_mu.Unlock()
+
+	sim_latch = (sim_latch | set) &^ clr
+	sim_dev.Drive(sim_latch & sim_oe, sim_oe)
+}
+
+func sim_level() uint32 {
+	sim_mu.Lock()
+	defer sim_mu.Unlock()
+
+	return (sim_latch & sim_oe) | (sim_dev.Level() &^ sim_oe)
+}
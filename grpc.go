@@ -0,0 +1,463 @@
+//go:build grpc
+// +build grpc
+
+//-----------------------------------------------------------------------------
+// grpc.go
+// nyacom (C) 2018.05
+// gRPC service (build with -tags grpc, see ficrpc/fic.proto)
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"io"
+	"fmt"
+	"net"
+	"time"
+	"bytes"
+	"strings"
+	"strconv"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"./ficrpc"
+	"./gpio"	// RPi GPIO lib
+)
+
+type ficServer struct {
+	ficrpc.UnimplementedFicServiceServer
+	mon *FicStat
+}
+
+func init() {
+	grpc_daemon = grpc_serve
+	daemon_features = append(daemon_features, "grpc")
+}
+
+// Map FicError to gRPC status
+func grpc_error_of(err error) error {
+	fe := fic_error_of(err)
+
+	code := codes.Internal
+	switch fe.Code {
+	case ERR_BAD_ARGS, ERR_SIZE_MISMATCH:
+		code = codes.InvalidArgument
+	case ERR_LOCK_TIMEOUT, ERR_LEASE_HELD:
+		code = codes.Unavailable
+	case ERR_COMM_TIMEOUT_FACK_UP, ERR_COMM_TIMEOUT_FACK_DOWN, ERR_WAIT_TIMEOUT, ERR_QUEUE_TIMEOUT,
+		ERR_PROG_INIT_TIMEOUT, ERR_PROG_DATA_TIMEOUT, ERR_PROG_DONE_TIMEOUT:
+		code = codes.DeadlineExceeded
+	case ERR_CANCELED:
+		code = codes.Canceled
+	case ERR_CONFIG_INIT_LOW:
+		code = codes.Aborted
+	case ERR_PR_MISMATCH, ERR_NOT_CONFIGURED:
+		code = codes.FailedPrecondition
+	case ERR_AUTH_REQUIRED, ERR_AUTH_FAILED:
+		code = codes.Unauthenticated
+	case ERR_FORBIDDEN:
+		code = codes.PermissionDenied
+	}
+
+	return status.Error(code, fe.Error())
+}
+
+//-----------------------------------------------------------------------------
+// Authentication ("authorization: Bearer <token>" metadata)
+//-----------------------------------------------------------------------------
+var grpc_method_cmd = map[string]string {
+	"/ficrpc.FicService/Program":       TERM_CMD_PROG,
+	"/ficrpc.FicService/WatchStatus":   TERM_CMD_STAT,
+	"/ficrpc.FicService/ReadRegister":  TERM_CMD_READ,
+	"/ficrpc.FicService/WriteRegister": TERM_CMD_WRITE,
+	"/ficrpc.FicService/InitFPGA":      TERM_CMD_INIT,
+}
+
+// Session of the call, errors are FicError
+func grpc_auth(ctx context.Context, method string)(s *Session, cmd string, err error) {
+	addr := ""
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		addr = p.Addr.String()
+	}
+	s = session_new(addr)
+	s.Proto = "grpc"
+	s.Close()
+	s.Ctx, s.Close = context.WithCancel(ctx)	// Canceled with the call
+
+	cmd, found := grpc_method_cmd[method]
+	if !found {
+		cmd = method	// Unknown methods require admin
+	}
+
+	// Client certificate
+	if ok {
+		if ti, tok := p.AuthInfo.(credentials.TLSInfo); tok && len(ti.State.PeerCertificates) > 0 {
+			if err := auth_login_cert(s, ti.State.PeerCertificates[0]); err != nil {
+				return s, cmd, err
+			}
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			token := strings.TrimPrefix(v, "Bearer ")
+			if err := auth_login(s, token); err != nil {
+				return s, cmd, err
+			}
+		}
+	}
+
+	if err := auth_check(s, cmd); err != nil {
+		return s, cmd, err
+	}
+	if err := lease_check(s, cmd); err != nil {
+		return s, cmd, err
+	}
+
+	return s, cmd, nil
+}
+
+type grpcSessionKey struct{}
+
+// Session stored by the interceptor
+func grpc_session(ctx context.Context)(*Session) {
+	s, _ := ctx.Value(grpcSessionKey{}).(*Session)
+	return s
+}
+
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpc_unary_auth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler)(interface{}, error) {
+	t1 := time.Now()
+	s, cmd, err := grpc_auth(ctx, info.FullMethod)
+	if err != nil {
+		audit_record(s, cmd, []string{info.FullMethod, fmt.Sprint(req)}, nil, t1, err)
+		return nil, grpc_error_of(err)
+	}
+
+	resp, err := handler(context.WithValue(ctx, grpcSessionKey{}, s), req)
+
+	audit_record(s, cmd, []string{info.FullMethod, fmt.Sprint(req)}, nil, t1, grpc_fic_error(err))
+
+	return resp, err
+}
+
+func grpc_stream_auth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	s, cmd, err := grpc_auth(ss.Context(), info.FullMethod)
+	if err != nil {
+		audit_record(s, cmd, []string{info.FullMethod}, nil, time.Now(), err)
+		return grpc_error_of(err)
+	}
+
+	// Note: Streaming handlers record audit log by themselves
+	return handler(srv, &grpcStream{ss, context.WithValue(ss.Context(), grpcSessionKey{}, s)})
+}
+
+// Run fn as a hardware operation of the calling session
+func grpc_sched(ctx context.Context, cmd string, fn func() error) error {
+	s := grpc_session(ctx)
+	return sched_run(ctx, cmd, s.Who(), cmd_prio[cmd], nil, fn)
+}
+
+// Recover FicError from gRPC status made by grpc_error_of
+func grpc_fic_error(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, _ := status.FromError(err)
+	kv := strings.SplitN(st.Message(), ": ", 2)
+	if _, ok := fic_err_num[kv[0]]; ok && len(kv) == 2 {
+		return fic_error(kv[0], kv[1])
+	}
+	return fic_error(ERR_INTERNAL, st.Message())
+}
+
+func grpc_reg_width(width uint32)(int, error) {
+	switch width {
+	case 0, 8:
+		return 1, nil
+	case 16, 32, 64:
+		return int(width / 8), nil
+	}
+	return 0, fic_errorf(ERR_BAD_ARGS, "Unsupported register width %d", width)
+}
+
+func grpc_stat(st FicStat)(*ficrpc.FicStat) {
+	return &ficrpc.FicStat{
+		TsUnixNano: st.Ts.UnixNano(),
+		State:  uint32(st.State),
+		Hls:    uint32(st.Hls),
+		Linkup: uint32(st.Linkup),
+		Dipsw:  uint32(st.Dipsw),
+		Led:    uint32(st.Led),
+		Chup:   uint32(st.Chup),
+		Done:   uint32(st.Done),
+		Pwr:    uint32(st.Pwr),
+		Ports:  grpc_ports(st.Ports),
+		Bitstream: grpc_bitstream(st.Bitstream),
+	}
+}
+
+func grpc_ports(ports []FicPort)([]*ficrpc.FicPort) {
+	res := make([]*ficrpc.FicPort, len(ports))
+	for i, p := range ports {
+		res[i] = &ficrpc.FicPort{
+			Port:     uint32(p.Port),
+			Link:     p.Link,
+			Chup:     p.Chup,
+			SinceUnixNano: p.Since.UnixNano(),
+			Changes:  uint32(p.Changes),
+			Flapping: p.Flapping,
+		}
+	}
+	return res
+}
+
+func grpc_bitstream(r *BitRecord)(*ficrpc.BitRecord) {
+	if r == nil {
+		return nil
+	}
+	b := &ficrpc.BitRecord{
+		Sha256: r.Sha256,
+		Size:   uint32(r.Size),
+		Name:   r.Name,
+		Width:  uint32(r.Width),
+		Pr:     r.PR,
+		ProgrammedUnixNano: r.Programmed.UnixNano(),
+		Client: r.Client,
+		Base:   r.Base,
+		Partial: grpc_bitstream(r.Partial),
+	}
+	if r.Bit != nil {
+		b.Bit = &ficrpc.BitInfo{
+			Design: r.Bit.Design,
+			Part:   r.Bit.Part,
+			Date:   r.Bit.Date,
+			Time:   r.Bit.Time,
+			Size:   uint32(r.Bit.Size),
+		}
+	}
+	if r.Partitions != nil {
+		b.Partitions = map[string]*ficrpc.PrLoaded{}
+		for name, m := range r.Partitions {
+			if m == nil {
+				b.Partitions[name] = &ficrpc.PrLoaded{}	// Unknown
+				continue
+			}
+			b.Partitions[name] = &ficrpc.PrLoaded{
+				Module: m.Module,
+				Sha256: m.Sha256,
+				ProgrammedUnixNano: m.Programmed.UnixNano(),
+				Client: m.Client,
+			}
+		}
+	}
+	return b
+}
+
+//-----------------------------------------------------------------------------
+// Program (client streaming)
+//-----------------------------------------------------------------------------
+func (s *ficServer) Program(stream ficrpc.FicService_ProgramServer) error {
+	var buf bytes.Buffer
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return grpc_error_of(fic_error(ERR_BAD_ARGS, "No program chunk"))
+	}
+	mode, pr, size, name := first.GetMode(), first.GetPr(), int(first.GetTotalSize()), first.GetName()
+	buf.Grow(size)
+	buf.Write(first.GetData())
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf.Write(chunk.GetData())
+	}
+
+	if size != 0 && buf.Len() != size {
+		return grpc_error_of(fic_errorf(ERR_SIZE_MISMATCH,
+			"Received bitstream size mismatch %d", size - buf.Len()))
+	}
+
+	fmt.Println("DEBUG: GRPC PROG", mode, pr, buf.Len())
+	t1 := time.Now()
+	cmd := map[bool]string{false: TERM_CMD_PROG, true: TERM_CMD_PROG_PR}[pr]
+	if mode == ficrpc.ProgMode_PROG_MODE_X8 {
+		cmd = map[bool]string{false: TERM_CMD_PROG8, true: TERM_CMD_PROG8_PR}[pr]
+	}
+	who := grpc_session(ctx).Who()
+	err = grpc_sched(stream.Context(), cmd, func() error {
+		width := 16
+		if mode == ficrpc.ProgMode_PROG_MODE_X8 {
+			width = 8
+		}
+		err := prog_record(ctx, who, name, buf.Bytes(), width, pr)
+		monitor_refresh(ctx, s.mon)	// Also on failure, DONE and partitions change
+		return err
+	})
+	audit_record(grpc_session(stream.Context()), cmd, []string{strconv.Itoa(buf.Len())}, buf.Bytes(), t1, err)
+	if err != nil {
+		return grpc_error_of(err)
+	}
+
+	return stream.SendAndClose(&ficrpc.ProgramResult{
+		Size: uint32(buf.Len()),
+		ElapsedSec: time.Now().Sub(t1).Seconds(),
+	})
+}
+
+//-----------------------------------------------------------------------------
+// WatchStatus (server streaming)
+//-----------------------------------------------------------------------------
+func (s *ficServer) WatchStatus(req *ficrpc.WatchStatusRequest, stream ficrpc.FicService_WatchStatusServer) error {
+	period := time.Duration(req.GetPeriodMs()) * time.Millisecond
+	if period == 0 {
+		period = GET_STATUS_PEIROD * time.Second
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		st := monitor_load(s.mon)
+		if req.GetRefresh() {
+			var err error
+			sess := grpc_session(stream.Context())
+			if st, err = monitor_get_status_sched(stream.Context(), sess.Who(), PRIO_INTERACTIVE); err != nil {
+				return grpc_error_of(err)
+			}
+		}
+		if err := stream.Send(grpc_stat(st)); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Unary
+//-----------------------------------------------------------------------------
+func (s *ficServer) ReadRegister(ctx context.Context, req *ficrpc.ReadRegisterRequest)(*ficrpc.RegisterValue, error) {
+	width, err := grpc_reg_width(req.GetWidth())
+	if err != nil {
+		return nil, grpc_error_of(err)
+	}
+	if req.GetAddr() > 0xffff {
+		return nil, grpc_error_of(fic_error(ERR_BAD_ARGS, "Register address out of range"))
+	}
+	endian := COM_ENDIAN_LITTLE
+	if req.GetBigEndian() {
+		endian = COM_ENDIAN_BIG
+	}
+
+	var v uint64
+	err = grpc_sched(ctx, TERM_CMD_READ, func() error {
+		if err := fic_lock(ctx); err != nil {
+			return err
+		}
+		defer gpio.Gpio_unlock()
+		v, err = fic_read_n(ctx, uint16(req.GetAddr()), width, endian, req.GetLatch())
+		return err
+	})
+	if err != nil {
+		return nil, grpc_error_of(err)
+	}
+
+	return &ficrpc.RegisterValue{Addr: req.GetAddr(), Value: v}, nil
+}
+
+func (s *ficServer) WriteRegister(ctx context.Context, req *ficrpc.WriteRegisterRequest)(*ficrpc.WriteRegisterResponse, error) {
+	width, err := grpc_reg_width(req.GetWidth())
+	if err != nil {
+		return nil, grpc_error_of(err)
+	}
+	if req.GetAddr() > 0xffff {
+		return nil, grpc_error_of(fic_error(ERR_BAD_ARGS, "Register address out of range"))
+	}
+	endian := COM_ENDIAN_LITTLE
+	if req.GetBigEndian() {
+		endian = COM_ENDIAN_BIG
+	}
+
+	err = grpc_sched(ctx, TERM_CMD_WRITE, func() error {
+		if err := fic_lock(ctx); err != nil {
+			return err
+		}
+		defer gpio.Gpio_unlock()
+		return fic_write_n(ctx, uint16(req.GetAddr()), width, req.GetValue(), endian, req.GetLatch())
+	})
+	if err != nil {
+		return nil, grpc_error_of(err)
+	}
+
+	return &ficrpc.WriteRegisterResponse{}, nil
+}
+
+func (s *ficServer) InitFPGA(ctx context.Context, req *ficrpc.InitFPGARequest)(*ficrpc.InitFPGAResponse, error) {
+	if err := grpc_sched(ctx, TERM_CMD_INIT, func() error {
+		if err := fic_fpga_init(ctx); err != nil {
+			return err
+		}
+		monitor_refresh(ctx, s.mon)
+		return nil
+	}); err != nil {
+		return nil, grpc_error_of(err)
+	}
+	return &ficrpc.InitFPGAResponse{}, nil
+}
+
+//-----------------------------------------------------------------------------
+// Listener
+//-----------------------------------------------------------------------------
+func grpc_serve(addr string, mon *FicStat) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println("ERROR: gRPC can't listen", addr, err)
+		return
+	}
+
+	sopts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpc_unary_auth),
+		grpc.StreamInterceptor(grpc_stream_auth),
+	}
+	if tls_enabled() {
+		sopts = append(sopts, grpc.Creds(credentials.NewTLS(tls_config())))
+	}
+
+	srv := grpc.NewServer(sopts...)
+	ficrpc.RegisterFicServiceServer(srv, &ficServer{mon: mon})
+
+	// Shutdown cancels active calls
+	go func() {
+		<-daemon_ctx.Done()
+		srv.Stop()
+	} ()
+
+	fmt.Println("FiCDaemon: gRPC listen on", addr)
+	if err := srv.Serve(listener); err != nil {
+		fmt.Println("ERROR: gRPC serve", err)
+	}
+}
@@ -0,0 +1,177 @@
+//-----------------------------------------------------------------------------
+// lease.go
+// nyacom (C) 2018.05
+// Board reservation: while a lease is held, mutating commands from
+// other clients are rejected. Leases expire automatically.
+// The lease of an anonymous client is bound to its connection, clients on
+// the same host (or Unix socket) are not the same owner.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+type Lease struct {
+	Owner  string		`json:"owner"`
+	Since  time.Time	`json:"since"`
+	Expire time.Time	`json:"expire"`
+}
+
+var (
+	lease_mu sync.Mutex
+	lease    *Lease	// nil for free
+)
+
+// Lease owner of session: identity, or the connection for anonymous clients
+func (s *Session) Owner() string {
+	if s.Identity != "" {
+		return s.Identity
+	}
+	return s.anonymous_owner()
+}
+
+func (s *Session) anonymous_owner() string {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		host = s.Addr
+	}
+	return fmt.Sprintf("%s#%d", host, s.Id)
+}
+
+// Release the lease taken anonymously on the closed connection
+func lease_session_end(s *Session) {
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	if l := lease_current(); l != nil && l.Owner == s.anonymous_owner() {
+		fmt.Println("DEBUG: LEASE RELEASE", l.Owner, "(disconnected)")
+		lease = nil
+	}
+}
+
+// Commands rejected while another client holds the lease
+func cmd_is_mutating(cmd string) bool {
+	return auth_default_policy[cmd] >= ROLE_OPERATOR
+}
+
+// Current lease, nil if free or expired (lease_mu must be held)
+func lease_current()(*Lease) {
+	if lease != nil && time.Now().After(lease.Expire) {
+		fmt.Println("DEBUG: LEASE EXPIRED", lease.Owner)
+		lease = nil
+	}
+	return lease
+}
+
+func lease_duration(sec int)(time.Duration, error) {
+	if sec <= 0 {
+		return LEASE_DEFAULT * time.Second, nil
+	}
+	if sec > LEASE_MAX {
+		return 0, fic_errorf(ERR_BAD_ARGS, "Lease duration exceeds %d sec", LEASE_MAX)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
+
+//-----------------------------------------------------------------------------
+func lease_reserve(s *Session, sec int)(Lease, error) {
+	d, err := lease_duration(sec)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	l := lease_current()
+	if l != nil && l.Owner != s.Owner() {
+		return *l, fic_errorf(ERR_LEASE_HELD, "Board is reserved by %s until %s",
+			l.Owner, l.Expire.Format(time.RFC3339))
+	}
+
+	// Reserving again does not shorten the own lease (RENEW does)
+	expire := time.Now().Add(d)
+	if l != nil {
+		if expire.After(l.Expire) {
+			l.Expire = expire
+		}
+	} else {
+		lease = &Lease{Owner: s.Owner(), Since: time.Now(), Expire: expire}
+	}
+	fmt.Println("DEBUG: LEASE RESERVE", lease.Owner, lease.Expire)
+	return *lease, nil
+}
+
+func lease_renew(s *Session, sec int)(Lease, error) {
+	d, err := lease_duration(sec)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	l := lease_current()
+	if l == nil || l.Owner != s.Owner() {
+		return Lease{}, fic_error(ERR_NO_LEASE, "No lease held by " + s.Owner())
+	}
+
+	l.Expire = time.Now().Add(d)
+	fmt.Println("DEBUG: LEASE RENEW", l.Owner, l.Expire)
+	return *l, nil
+}
+
+// Release own lease, admin may force release
+func lease_release(s *Session, force bool) error {
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	l := lease_current()
+	if l == nil {
+		return nil
+	}
+	if l.Owner != s.Owner() {
+		if !force {
+			return fic_errorf(ERR_LEASE_HELD, "Board is reserved by %s", l.Owner)
+		}
+		if err := auth_check_role(s, ROLE_ADMIN, "RELEASE force"); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("DEBUG: LEASE RELEASE", l.Owner, "by", s.Owner())
+	lease = nil
+	return nil
+}
+
+func lease_who()(*Lease) {
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	if l := lease_current(); l != nil {
+		c := *l
+		return &c
+	}
+	return nil
+}
+
+// Check if session may run the command under current lease
+func lease_check(s *Session, cmd string) error {
+	if !cmd_is_mutating(cmd) {
+		return nil
+	}
+
+	lease_mu.Lock()
+	defer lease_mu.Unlock()
+
+	l := lease_current()
+	if l == nil || l.Owner == s.Owner() {
+		return nil
+	}
+	return fic_errorf(ERR_LEASE_HELD, "%s rejected, board is reserved by %s until %s",
+		cmd, l.Owner, l.Expire.Format(time.RFC3339))
+}
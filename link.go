@@ -0,0 +1,86 @@
+//-----------------------------------------------------------------------------
+// link.go
+// nyacom (C) 2018.05
+// Per port link state from FIC_REG_LINKUP and FIC_REG_CHUP
+//
+// Bit N of the registers is port N. Changes are counted per port on every
+// status refresh (GET_STATUS_PEIROD), a port with LINK_FLAP_COUNT changes in
+// LINK_FLAP_WINDOW is reported as flapping. The links go down while the
+// FPGA is configured, the changes before INIT and PROG are not counted then.
+// Note: Changes faster than the refresh period are not seen.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type FicPort struct {
+	Port     int		`json:"port"`
+	Link     bool		`json:"link"`		// LINKUP bit
+	Chup     bool		`json:"chup"`		// CHUP bit
+	Since    time.Time	`json:"since"`		// Last change (first sample if none)
+	Changes  int		`json:"changes"`	// Since daemon start
+	Flapping bool		`json:"flapping"`
+}
+
+type link_history struct {
+	seen    bool
+	link    bool
+	chup    bool
+	since   time.Time
+	changes int
+	recent  []time.Time	// Changes in LINK_FLAP_WINDOW
+}
+
+var (
+	link_mu   sync.Mutex
+	link_hist [FIC_PORTS]link_history
+)
+
+// Decode st.Linkup and st.Chup into st.Ports and record changes
+func link_update(st *FicStat) {
+	link_mu.Lock()
+	defer link_mu.Unlock()
+
+	window := st.Ts.Add(-LINK_FLAP_WINDOW * time.Second)
+	st.Ports = make([]FicPort, FIC_PORTS)
+
+	for i := range link_hist {
+		h := &link_hist[i]
+		link := st.Linkup & (1 << uint(i)) != 0
+		chup := st.Chup & (1 << uint(i)) != 0
+
+		if !h.seen {
+			h.seen, h.link, h.chup, h.since = true, link, chup, st.Ts
+		} else if link != h.link || chup != h.chup {
+			h.link, h.chup, h.since = link, chup, st.Ts
+			h.changes++
+			h.recent = append(h.recent, st.Ts)
+		}
+
+		for len(h.recent) > 0 && h.recent[0].Before(window) {
+			h.recent = h.recent[1:]
+		}
+
+		st.Ports[i] = FicPort{
+			Port: i,
+			Link: link,
+			Chup: chup,
+			Since: h.since,
+			Changes: h.changes,
+			Flapping: len(h.recent) >= LINK_FLAP_COUNT,
+		}
+	}
+}
+
+// Forget the recent changes (FPGA reconfigured)
+func link_reset() {
+	link_mu.Lock()
+	defer link_mu.Unlock()
+
+	for i := range link_hist {
+		link_hist[i].recent = nil
+	}
+}
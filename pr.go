@@ -0,0 +1,230 @@
+//-----------------------------------------------------------------------------
+// pr.go
+// nyacom (C) 2018.05
+// Partial reconfiguration regions
+//
+// PR config (PR_CONFIG_PATH, -pr-config, JSON)
+//  {"bases": [
+//    {"name": "ring", "sha256": "<of base .bin>",
+//     "partitions": [
+//       {"name": "rp0", "default": "nop", "modules": [  // default: in the base
+//         {"name": "nop",   "sha256": "<of partial .bin>"},
+//         {"name": "adder", "sha256": "..."}
+//       ]}
+//     ]}
+//  ]}
+// A partial (PROGPR) is accepted only when the loaded base, the last full
+// configuration (bitstream.go), is in the config and the partial is a module
+// of one of its partitions. The module in each partition is recorded with
+// the bitstream state, null if unknown (e.g. after a failed partial).
+// Without the config file partials are not checked, the last one is recorded
+// with the base (bitstream.go).
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"time"
+	"strings"
+	"encoding/json"
+)
+
+type PrModule struct {
+	Name   string	`json:"name"`
+	Sha256 string	`json:"sha256"`
+}
+
+type PrPartition struct {
+	Name    string		`json:"name"`
+	Default string		`json:"default,omitempty"`
+	Modules []PrModule	`json:"modules"`
+}
+
+type PrBase struct {
+	Name       string		`json:"name"`
+	Sha256     string		`json:"sha256"`
+	Partitions []PrPartition	`json:"partitions"`
+}
+
+type PrConf struct {
+	Bases []PrBase	`json:"bases"`
+}
+
+// Module loaded in a partition
+type PrLoaded struct {
+	Module     string	`json:"module"`
+	Sha256     string	`json:"sha256"`
+	Programmed time.Time	`json:"programmed"`	// Of the base for the default module
+	Client     string	`json:"client"`
+}
+
+var (
+	pr_mu   sync.Mutex
+	pr_conf *PrConf		// nil if partials are not checked
+	pr_path = PR_CONFIG_PATH
+)
+
+func pr_load(path string, reload bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		pr_mu.Lock()
+		defer pr_mu.Unlock()
+		if reload && pr_conf != nil {
+			return fic_error(ERR_BAD_ARGS, "PR config " + path + " is missing, keeping the current config")
+		}
+		fmt.Println("WARNING: No PR config", path, "(partials are not checked)")
+		pr_conf = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	conf := &PrConf{}
+	if err := json.NewDecoder(f).Decode(conf); err != nil {
+		return fic_error(ERR_JSON, "PR config: " + err.Error())
+	}
+
+	// Validate, hashes must be unique so that a partial maps to one module
+	hashes := map[string]string{}
+	unique := func(sha string, what string) error {
+		if sha == "" {
+			return fic_error(ERR_BAD_ARGS, "PR config: no sha256 for " + what)
+		}
+		if prev, ok := hashes[sha]; ok {
+			return fic_errorf(ERR_BAD_ARGS, "PR config: %s has the same sha256 as %s", what, prev)
+		}
+		hashes[sha] = what
+		return nil
+	}
+	for i := range conf.Bases {
+		b := &conf.Bases[i]
+		b.Sha256 = strings.ToLower(b.Sha256)
+		if err := unique(b.Sha256, "base " + b.Name); err != nil {
+			return err
+		}
+
+		parts := map[string]bool{}
+		for j := range b.Partitions {
+			p := &b.Partitions[j]
+			if p.Name == "" || parts[p.Name] {
+				return fic_errorf(ERR_BAD_ARGS, "PR config: base %s: invalid partition name '%s'", b.Name, p.Name)
+			}
+			parts[p.Name] = true
+
+			def := p.Default == ""
+			for k := range p.Modules {
+				m := &p.Modules[k]
+				m.Sha256 = strings.ToLower(m.Sha256)
+				if err := unique(m.Sha256, b.Name + "/" + p.Name + "/" + m.Name); err != nil {
+					return err
+				}
+				def = def || m.Name == p.Default
+			}
+			if !def {
+				return fic_errorf(ERR_BAD_ARGS, "PR config: %s/%s: default %s is not a module", b.Name, p.Name, p.Default)
+			}
+		}
+	}
+
+	pr_mu.Lock()
+	pr_conf = conf
+	pr_mu.Unlock()
+	fmt.Println("DEBUG: PR config", path, len(conf.Bases), "bases")
+	return nil
+}
+
+func (c *PrConf) base(sha string)(*PrBase) {
+	for i := range c.Bases {
+		if c.Bases[i].Sha256 == sha {
+			return &c.Bases[i]
+		}
+	}
+	return nil
+}
+
+func (b *PrBase) module(sha string)(*PrPartition, *PrModule) {
+	for i := range b.Partitions {
+		p := &b.Partitions[i]
+		for j := range p.Modules {
+			if p.Modules[j].Sha256 == sha {
+				return p, &p.Modules[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+//-----------------------------------------------------------------------------
+// Base name and partitions with the default modules for a full configuration
+// ("", nil if not a PR base)
+//-----------------------------------------------------------------------------
+func pr_base(r *BitRecord)(string, map[string]*PrLoaded) {
+	pr_mu.Lock()
+	defer pr_mu.Unlock()
+
+	if pr_conf == nil {
+		return "", nil
+	}
+	b := pr_conf.base(r.Sha256)
+	if b == nil {
+		return "", nil
+	}
+
+	parts := map[string]*PrLoaded{}
+	for _, p := range b.Partitions {
+		parts[p.Name] = nil
+		for _, m := range p.Modules {
+			if m.Name == p.Default {
+				parts[p.Name] = &PrLoaded{Module: m.Name, Sha256: m.Sha256, Programmed: r.Programmed, Client: r.Client}
+			}
+		}
+	}
+	return b.Name, parts
+}
+
+// Partition of a partial, "" if not checked
+func pr_check(sha string)(string, *PrModule, error) {
+	pr_mu.Lock()
+	defer pr_mu.Unlock()
+
+	if pr_conf == nil {
+		return "", nil, nil
+	}
+
+	r := bitstream_current()
+	if r == nil || r.PR {
+		return "", nil, fic_error(ERR_PR_MISMATCH, "Loaded base design is unknown")
+	}
+	b := pr_conf.base(r.Sha256)
+	if b == nil {
+		return "", nil, fic_errorf(ERR_PR_MISMATCH, "Loaded design %.12s is not a PR base", r.Sha256)
+	}
+	p, m := b.module(sha)
+	if m == nil {
+		return "", nil, fic_errorf(ERR_PR_MISMATCH, "Partial %.12s does not match base %s", sha, b.Name)
+	}
+	return p.Name, m, nil
+}
+
+// Record the module in part, nil if the partial failed
+func pr_record(part string, loaded *PrLoaded) {
+	bitstream_mu.Lock()
+	defer bitstream_mu.Unlock()
+
+	if bitstream == nil {
+		return	// Invalidated meanwhile
+	}
+
+	// Copy, the map of the current record is shared with STAT
+	r := *bitstream
+	r.Partitions = map[string]*PrLoaded{}
+	for k, v := range bitstream.Partitions {
+		r.Partitions[k] = v
+	}
+	r.Partitions[part] = loaded
+	bitstream_save(&r)
+}
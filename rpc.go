@@ -0,0 +1,392 @@
+//-----------------------------------------------------------------------------
+// rpc.go
+// nyacom (C) 2018.05
+// JSON-RPC 2.0 interface (TCP and Unix domain socket)
+// Requests are newline delimited JSON objects or batch arrays
+// A line is at most FRAME_SMALLSIZE, FRAME_MAXSIZE for a session authorized
+// for PROG (base64 bitstream), the connection is closed on longer lines.
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"time"
+	"bytes"
+	"bufio"
+	"strconv"
+	"syscall"
+	"encoding/json"
+	"encoding/base64"
+	"./gpio"	// RPi GPIO lib
+)
+
+//-----------------------------------------------------------------------------
+// JSON-RPC error codes
+//-----------------------------------------------------------------------------
+const (
+	RPC_ERR_PARSE          = -32700
+	RPC_ERR_INVALID_REQ    = -32600
+	RPC_ERR_NO_METHOD      = -32601
+	RPC_ERR_INVALID_PARAMS = -32602
+	RPC_ERR_INTERNAL       = -32603
+	RPC_ERR_SERVER         = -32000	// -32000 - FicError.Num()
+)
+
+type RpcRequest struct {
+	Jsonrpc string			`json:"jsonrpc"`
+	Method  string			`json:"method"`
+	Params  json.RawMessage		`json:"params,omitempty"`
+	Id      json.RawMessage		`json:"id,omitempty"`
+}
+
+type RpcError struct {
+	Code    int			`json:"code"`
+	Message string			`json:"message"`
+	Data    interface{}		`json:"data,omitempty"`
+}
+
+type RpcResponse struct {
+	Jsonrpc string			`json:"jsonrpc"`
+	Result  interface{}		`json:"result,omitempty"`
+	Error   *RpcError		`json:"error,omitempty"`
+	Id      json.RawMessage		`json:"id"`
+}
+
+// Method parameters
+type RpcStatusParams struct {
+	Refresh bool	`json:"refresh"`	// Read registers instead of cached status
+}
+
+type RpcRegParams struct {
+	Addr uint16	`json:"addr"`
+	Data uint8	`json:"data"`
+}
+
+type RpcAuthParams struct {
+	Token string	`json:"token"`
+}
+
+type RpcProgParams struct {
+	Bitstream string	`json:"bitstream"`	// base64
+	Pr        bool		`json:"pr"`		// Partial reconfiguration
+	Name      string	`json:"name,omitempty"`	// File name (recorded)
+}
+
+func rpc_error_of(err error)(*RpcError) {
+	fe := fic_error_of(err)
+	return &RpcError{
+		Code: RPC_ERR_SERVER - int(fe.Num()),
+		Message: fe.Msg,
+		Data: map[string]string{"code": fe.Code},
+	}
+}
+
+// Terminal command equivalent of each method for authorization
+var rpc_method_cmd = map[string]string {
+	"auth":               TERM_CMD_AUTH,
+	"monitor_get_status": TERM_CMD_STAT,
+	"fic_read8":          TERM_CMD_READ,
+	"fic_write8":         TERM_CMD_WRITE,
+	"Prog8":              TERM_CMD_PROG8,
+	"Prog16":             TERM_CMD_PROG,
+	"fic_fpga_init":      TERM_CMD_INIT,
+}
+
+//-----------------------------------------------------------------------------
+// Dispatch one method call
+//-----------------------------------------------------------------------------
+func rpc_call(s *Session, method string, params json.RawMessage, mon *FicStat)(result interface{}, rerr *RpcError) {
+	var bitstream []byte	// For audit log
+	decode := func(v interface{}) *RpcError {
+		if len(params) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(params, v); err != nil {
+			return &RpcError{Code: RPC_ERR_INVALID_PARAMS, Message: err.Error()}
+		}
+		return nil
+	}
+
+	cmd, ok := rpc_method_cmd[method]
+	if !ok {
+		return nil, &RpcError{Code: RPC_ERR_NO_METHOD, Message: "Method not found: " + method}
+	}
+
+	t1 := time.Now()
+	defer func() {
+		var err error
+		if rerr != nil {
+			code := ERR_BAD_ARGS
+			if d, ok := rerr.Data.(map[string]string); ok {
+				code = d["code"]
+			}
+			err = fic_error(code, rerr.Message)
+		}
+		// Method and params size only, params may hold a whole bitstream
+		args := []string{method, strconv.Itoa(len(params))}
+		audit_record(s, cmd, args, bitstream, t1, err)
+	} ()
+	if err := auth_check(s, cmd); err != nil {
+		return nil, rpc_error_of(err)
+	}
+	if err := lease_check(s, cmd); err != nil {
+		return nil, rpc_error_of(err)
+	}
+
+	// Hardware operations go through the scheduler
+	prio, hw := cmd_prio[cmd]
+	if !hw {
+		return rpc_exec(s, method, decode, &bitstream, mon)
+	}
+	err := sched_run(s.Ctx, method, s.Who(), prio, s.Queued, func() error {
+		result, rerr = rpc_exec(s, method, decode, &bitstream, mon)
+		return nil
+	})
+	if err != nil {
+		return nil, rpc_error_of(err)
+	}
+	return result, rerr
+}
+
+func rpc_exec(s *Session, method string, decode func(interface{}) *RpcError, bitstream *[]byte, mon *FicStat)(interface{}, *RpcError) {
+	ctx := s.Ctx
+
+	switch method {
+	case "auth":
+		var p RpcAuthParams
+		if e := decode(&p); e != nil {
+			return nil, e
+		}
+		if err := auth_login(s, p.Token); err != nil {
+			return nil, rpc_error_of(err)
+		}
+		return map[string]string{"identity": s.Who(), "role": role_name(s.Role)}, nil
+
+	case "monitor_get_status":
+		var p RpcStatusParams
+		if e := decode(&p); e != nil {
+			return nil, e
+		}
+		if !p.Refresh {
+			return monitor_load(mon), nil
+		}
+		st, err := monitor_get_status_sched(s.Ctx, s.Who(), PRIO_INTERACTIVE)
+		if err != nil {
+			return nil, rpc_error_of(err)
+		}
+		return st, nil
+
+	case "fic_read8":
+		var p RpcRegParams
+		if e := decode(&p); e != nil {
+			return nil, e
+		}
+		if err := fic_lock(ctx); err != nil {
+			return nil, rpc_error_of(err)
+		}
+		data, err := fic_read8(ctx, p.Addr)
+		gpio.Gpio_unlock()
+		if err != nil {
+			return nil, rpc_error_of(err)
+		}
+		return data, nil
+
+	case "fic_write8":
+		var p RpcRegParams
+		if e := decode(&p); e != nil {
+			return nil, e
+		}
+		if err := fic_lock(ctx); err != nil {
+			return nil, rpc_error_of(err)
+		}
+		err := fic_write8(ctx, p.Addr, p.Data)
+		gpio.Gpio_unlock()
+		if err != nil {
+			return nil, rpc_error_of(err)
+		}
+		return true, nil
+
+	case "Prog8", "Prog16":
+		var p RpcProgParams
+		if e := decode(&p); e != nil {
+			return nil, e
+		}
+		var err error
+		*bitstream, err = base64.StdEncoding.DecodeString(p.Bitstream)
+		if err != nil {
+			return nil, &RpcError{Code: RPC_ERR_INVALID_PARAMS, Message: "bitstream: " + err.Error()}
+		}
+		if method == "Prog8" {
+			err = prog_record(ctx, s.Who(), p.Name, *bitstream, 8, p.Pr)
+		} else {
+			err = prog_record(ctx, s.Who(), p.Name, *bitstream, 16, p.Pr)
+		}
+		monitor_refresh(ctx, mon)	// Also on failure, DONE and partitions change
+		if err != nil {
+			return nil, rpc_error_of(err)
+		}
+		return true, nil
+
+	case "fic_fpga_init":
+		if err := fic_fpga_init(ctx); err != nil {
+			return nil, rpc_error_of(err)
+		}
+		monitor_refresh(ctx, mon)
+		return true, nil
+	}
+
+	return nil, &RpcError{Code: RPC_ERR_NO_METHOD, Message: "Method not found: " + method}
+}
+
+// Handle a single request object, nil response for notification
+func rpc_handle(s *Session, raw json.RawMessage, mon *FicStat)(*RpcResponse) {
+	var req RpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return &RpcResponse{Jsonrpc: "2.0", Id: json.RawMessage("null"),
+			Error: &RpcError{Code: RPC_ERR_INVALID_REQ, Message: err.Error()}}
+	}
+
+	id := req.Id
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	if req.Jsonrpc != "2.0" || req.Method == "" {
+		return &RpcResponse{Jsonrpc: "2.0", Id: id,
+			Error: &RpcError{Code: RPC_ERR_INVALID_REQ, Message: "Invalid request"}}
+	}
+
+	fmt.Println("DEBUG: RPC", req.Method)
+	result, rerr := rpc_call(s, req.Method, req.Params, mon)
+
+	if len(req.Id) == 0 {
+		return nil	// Notification
+	}
+
+	if rerr != nil {
+		return &RpcResponse{Jsonrpc: "2.0", Id: id, Error: rerr}
+	}
+	return &RpcResponse{Jsonrpc: "2.0", Id: id, Result: result}
+}
+
+//-----------------------------------------------------------------------------
+// Connection
+//-----------------------------------------------------------------------------
+// Read one line of at most max bytes, the rest of a longer line is not read
+func rpc_read_line(r *bufio.Reader, max int)([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		if len(line) + len(frag) > max {
+			return nil, fic_errorf(ERR_BAD_FRAME, "Request longer than %d B", max)
+		}
+		line = append(line, frag...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+func rpc_conn(conn net.Conn, mon *FicStat) {
+	defer conn.Close()
+
+	s, err := session_from_conn(conn)
+	if err != nil {
+		fmt.Println("DEBUG: RPC session error", conn.RemoteAddr(), err)
+		return
+	}
+	defer s.Close()
+	s.Proto = "jsonrpc"
+	r := bufio.NewReader(conn)
+	enc := json.NewEncoder(conn)
+
+	for {
+		max := FRAME_SMALLSIZE
+		if auth_check(s, TERM_CMD_PROG) == nil {
+			max = FRAME_MAXSIZE
+		}
+		line, err := rpc_read_line(r, max)
+		if fe, ok := err.(*FicError); ok {
+			enc.Encode(RpcResponse{Jsonrpc: "2.0", Id: json.RawMessage("null"),
+				Error: &RpcError{Code: RPC_ERR_INVALID_REQ, Message: fe.Error()}})
+			break
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			stop := func() {}
+			if err == nil {
+				stop = monitor_watch_disconnect(conn, r, s)
+			}
+			if line[0] == '[' {
+				// Batch
+				var batch []json.RawMessage
+				if jerr := json.Unmarshal(line, &batch); jerr != nil || len(batch) == 0 {
+					enc.Encode(RpcResponse{Jsonrpc: "2.0", Id: json.RawMessage("null"),
+						Error: &RpcError{Code: RPC_ERR_INVALID_REQ, Message: "Invalid batch"}})
+				} else {
+					resps := []*RpcResponse{}
+					for _, raw := range batch {
+						if resp := rpc_handle(s, raw, mon); resp != nil {
+							resps = append(resps, resp)
+						}
+					}
+					if len(resps) > 0 {
+						enc.Encode(resps)
+					}
+				}
+
+			} else if !json.Valid(line) {
+				enc.Encode(RpcResponse{Jsonrpc: "2.0", Id: json.RawMessage("null"),
+					Error: &RpcError{Code: RPC_ERR_PARSE, Message: "Parse error"}})
+
+			} else if resp := rpc_handle(s, line, mon); resp != nil {
+				enc.Encode(resp)
+			}
+			stop()
+		}
+
+		if err != nil {
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Listener (network is "tcp" or "unix")
+//-----------------------------------------------------------------------------
+func rpc_daemon(network string, addr string, mon *FicStat) {
+	if network == "unix" {
+		os.Remove(addr)	// Stale socket
+	}
+
+	// Socket is created with RPC_SOCK_PERM, not changed after bind
+	mask := -1
+	if network == "unix" {
+		mask = syscall.Umask(0777 &^ RPC_SOCK_PERM)
+	}
+	listener, err := tls_listen(network, addr)
+	if mask >= 0 {
+		syscall.Umask(mask)
+	}
+	if err != nil {
+		fmt.Println("ERROR: RPC can't listen", network, addr, err)
+		return
+	}
+	defer listener.Close()
+	monitor_close_on_shutdown(listener)
+
+	fmt.Println("FiCDaemon: RPC listen on", network, addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if daemon_ctx.Err() == nil {
+				fmt.Println("ERROR: RPC can't accept", err)
+			}
+			return
+		}
+
+		go rpc_conn(conn, mon)
+	}
+}
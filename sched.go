@@ -0,0 +1,202 @@
+//-----------------------------------------------------------------------------
+// sched.go
+// nyacom (C) 2018.05
+// Hardware operation scheduler
+// One hardware operation runs at a time. Waiting operations are served by
+// priority, then by arrival. Each operation has a deadline for waiting in
+// the queue and is canceled with its context (e.g. client disconnect).
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"context"
+	"container/heap"
+)
+
+// Priorities (higher first)
+const (
+	PRIO_BACKGROUND  = 0	// Daemon status polling
+	PRIO_NORMAL      = 1	// Programming, writes
+	PRIO_INTERACTIVE = 2	// Client reads
+	PRIO_SHUTDOWN    = 3	// Daemon shutdown
+)
+
+type HwOp struct {
+	Id       uint64		`json:"id"`
+	Name     string		`json:"name"`
+	Owner    string		`json:"owner"`
+	Prio     int		`json:"prio"`
+	Enqueued time.Time	`json:"enqueued"`
+	Started  time.Time	`json:"started,omitempty"`
+	Deadline time.Time	`json:"deadline"`	// For waiting in the queue
+	Pos      int		`json:"pos"`		// Queue position (0: running)
+
+	index    int
+	ready    chan struct{}
+}
+
+type hwQueue []*HwOp
+
+func (q hwQueue) Len() int { return len(q) }
+func (q hwQueue) Less(i, j int) bool {
+	if q[i].Prio != q[j].Prio {
+		return q[i].Prio > q[j].Prio
+	}
+	return q[i].Id < q[j].Id
+}
+func (q hwQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *hwQueue) Push(x interface{}) {
+	op := x.(*HwOp)
+	op.index = len(*q)
+	*q = append(*q, op)
+}
+func (q *hwQueue) Pop() interface{} {
+	old := *q
+	op := old[len(old)-1]
+	op.index = -1
+	*q = old[:len(old)-1]
+	return op
+}
+
+var (
+	sched_mu      sync.Mutex
+	sched_queue   hwQueue
+	sched_running *HwOp
+	sched_seq     uint64
+)
+
+// Position of op in the waiting queue (1 origin, sched_mu must be held)
+func sched_pos(op *HwOp) int {
+	pos := 1
+	for _, o := range sched_queue {
+		if o != op && sched_queue.Less(o.index, op.index) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// Grant next operation (sched_mu must be held)
+func sched_next() {
+	if sched_running != nil || len(sched_queue) == 0 {
+		return
+	}
+	op := heap.Pop(&sched_queue).(*HwOp)
+	op.Started = time.Now()
+	sched_running = op
+	close(op.ready)
+}
+
+//-----------------------------------------------------------------------------
+// Wait for the hardware, returns release function
+// queued is called with the queue position if the operation has to wait
+//-----------------------------------------------------------------------------
+func sched_acquire(ctx context.Context, name string, owner string, prio int, queued func(pos int))(func(), error) {
+	sched_mu.Lock()
+	sched_seq++
+	now := time.Now()
+	op := &HwOp{
+		Id: sched_seq, Name: name, Owner: owner, Prio: prio,
+		Enqueued: now, Deadline: now.Add(SCHED_DEADLINE * time.Second),
+		ready: make(chan struct{}),
+	}
+	if d, ok := ctx.Deadline(); ok && d.Before(op.Deadline) {
+		op.Deadline = d
+	}
+	heap.Push(&sched_queue, op)
+	sched_next()
+
+	if sched_running != op && queued != nil {
+		pos := sched_pos(op)
+		sched_mu.Unlock()
+		queued(pos)
+	} else {
+		sched_mu.Unlock()
+	}
+
+	timer := time.NewTimer(op.Deadline.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-op.ready:
+	case <-ctx.Done():
+		if sched_cancel(op) {
+			return nil, fic_errorf(ERR_CANCELED, "%s canceled while queued", name)
+		}
+	case <-timer.C:
+		if sched_cancel(op) {
+			return nil, fic_errorf(ERR_QUEUE_TIMEOUT, "%s waited over deadline in queue", name)
+		}
+	}
+
+	// Granted
+	release := func() {
+		sched_mu.Lock()
+		if sched_running == op {
+			sched_running = nil
+		}
+		sched_next()
+		sched_mu.Unlock()
+	}
+	return release, nil
+}
+
+// Remove waiting op, false if it has been granted meanwhile
+func sched_cancel(op *HwOp) bool {
+	sched_mu.Lock()
+	defer sched_mu.Unlock()
+
+	if op.index < 0 {
+		return false
+	}
+	heap.Remove(&sched_queue, op.index)
+	fmt.Println("DEBUG: SCHED CANCEL", op.Id, op.Name, op.Owner)
+	return true
+}
+
+// Run fn as one hardware operation
+func sched_run(ctx context.Context, name string, owner string, prio int, queued func(pos int), fn func() error) error {
+	release, err := sched_acquire(ctx, name, owner, prio, queued)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn()
+}
+
+//-----------------------------------------------------------------------------
+// Queue snapshot for QUEUE
+//-----------------------------------------------------------------------------
+type SchedStat struct {
+	Depth   int	`json:"depth"`
+	Running *HwOp	`json:"running"`
+	Waiting []HwOp	`json:"waiting"`
+}
+
+func sched_stat()(st SchedStat) {
+	sched_mu.Lock()
+	defer sched_mu.Unlock()
+
+	if sched_running != nil {
+		r := *sched_running
+		st.Running = &r
+	}
+	st.Waiting = []HwOp{}
+	for _, op := range sched_queue {
+		o := *op
+		o.Pos = sched_pos(op)
+		st.Waiting = append(st.Waiting, o)
+	}
+	sort.Slice(st.Waiting, func(i, j int) bool { return st.Waiting[i].Pos < st.Waiting[j].Pos })
+	st.Depth = len(st.Waiting)
+	return st
+}
@@ -0,0 +1,128 @@
+//-----------------------------------------------------------------------------
+// bitfile.go
+// nyacom (C) 2018.05
+// Xilinx bitstream files (.bit with header, .bin raw)
+//
+// .bit header (big endian)
+//  uint16 9, 9 bytes magic, uint16 1
+//  'a' uint16 len, design name
+//  'b' uint16 len, part
+//  'c' uint16 len, date
+//  'd' uint16 len, time
+//  'e' uint32 len, configuration data (same as .bin)
+//-----------------------------------------------------------------------------
+package selectmap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"io/ioutil"
+	"encoding/binary"
+)
+
+var (
+	ErrBitHeader = errors.New("broken .bit header")
+	ErrNoSync    = errors.New("sync word not found in bitstream")
+)
+
+var bit_magic = []byte{0x00, 0x09, 0x0f, 0xf0, 0x0f, 0xf0, 0x0f, 0xf0, 0x0f, 0xf0, 0x00, 0x00, 0x01}
+
+// Configuration sync word
+var sync_word = []byte{0xaa, 0x99, 0x55, 0x66}
+
+type BitInfo struct {
+	Design string	`json:"design,omitempty"`
+	Part   string	`json:"part,omitempty"`
+	Date   string	`json:"date,omitempty"`
+	Time   string	`json:"time,omitempty"`
+	Size   int	`json:"size"`		// Configuration data size
+}
+
+func Is_bit(data []byte) bool {
+	return bytes.HasPrefix(data, bit_magic)
+}
+
+//-----------------------------------------------------------------------------
+// Split .bit into header info and configuration data
+//-----------------------------------------------------------------------------
+func Parse_bit(data []byte)(bin []byte, info BitInfo, err error) {
+	if !Is_bit(data) {
+		return nil, info, ErrBitHeader
+	}
+
+	p := len(bit_magic)
+	for p < len(data) {
+		key := data[p]
+		p++
+
+		if key == 'e' {
+			if p + 4 > len(data) {
+				return nil, info, ErrBitHeader
+			}
+			size := int(binary.BigEndian.Uint32(data[p:p+4]))
+			p += 4
+			if size > len(data) - p {
+				return nil, info, ErrBitHeader
+			}
+			info.Size = size
+			return data[p:p+size], info, nil
+		}
+
+		if p + 2 > len(data) {
+			return nil, info, ErrBitHeader
+		}
+		n := int(binary.BigEndian.Uint16(data[p:p+2]))
+		p += 2
+		if n > len(data) - p {
+			return nil, info, ErrBitHeader
+		}
+		s := strings.TrimRight(string(data[p:p+n]), "\x00")
+		p += n
+
+		switch key {
+		case 'a':
+			info.Design = s
+		case 'b':
+			info.Part = s
+		case 'c':
+			info.Date = s
+		case 'd':
+			info.Time = s
+		}
+	}
+
+	return nil, info, ErrBitHeader
+}
+
+//-----------------------------------------------------------------------------
+// Load .bit or .bin file, returns configuration data
+// Note: The format is detected by the header, not by the file extension
+//-----------------------------------------------------------------------------
+func Load(path string)(bin []byte, info BitInfo, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, info, err
+	}
+
+	if Is_bit(data) {
+		return Parse_bit(data)
+	}
+
+	info.Size = len(data)
+	return data, info, nil
+}
+
+// Sanity check of configuration data before programming
+func Check(bin []byte, width int) error {
+	if width != 8 && width != 16 {
+		return ErrWidth
+	}
+	if width == 16 && len(bin) % 2 != 0 {
+		return ErrOddSize
+	}
+	if !bytes.Contains(bin, sync_word) {
+		return ErrNoSync
+	}
+	return nil
+}
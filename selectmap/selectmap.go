@@ -0,0 +1,307 @@
+//-----------------------------------------------------------------------------
+// selectmap.go
+// nyacom (C) 2018.05
+// Xilinx SelectMAP x16 x8 interface
+// References
+// https://japan.xilinx.com/support/documentation/application_notes/j_xapp583-fpga-configuration.pdf
+// https://japan.xilinx.com/support/documentation/user_guides/j_ug570-ultrascale-configuration.pdf
+//
+// Note: Program does not take the GPIO lock, the caller must hold it.
+//-----------------------------------------------------------------------------
+package selectmap
+
+import (
+	"errors"
+	"time"
+	"context"
+	"../gpio"
+)
+
+//-----------------------------------------------------------------------------
+// PRi PINS (BCM number)
+//-----------------------------------------------------------------------------
+var PIN = map[string] uint32 {
+	"RP_INIT" : 4,
+	"RP_PROG" : 5,
+	"RP_DONE" : 6,
+	"RP_CCLK" : 7,
+
+	"RP_CD0" : 8,
+	"RP_CD1" : 9,
+	"RP_CD2" : 10,
+	"RP_CD3" : 11,
+	"RP_CD4" : 12,
+	"RP_CD5" : 13,
+	"RP_CD6" : 14,
+	"RP_CD7" : 15,
+	"RP_CD8" : 16,
+	"RP_CD9" : 17,
+	"RP_CD10" : 18,
+	"RP_CD11" : 19,
+	"RP_CD12" : 20,
+	"RP_CD13" : 21,
+	"RP_CD14" : 22,
+	"RP_CD15" : 23,
+	"RP_CD16" : 24,
+	"RP_CD17" : 25,
+
+	"RP_PWOK" : 24,
+	"RP_G_CKSEL" : 25,
+	"RP_CSI" : 26,
+	"RP_RDWR" : 27,
+}
+
+var PIN_BIT = map[string] uint32 {
+	"RP_PWOK" : (1 << PIN["RP_PWOK"]),	// Input
+	"RP_INIT" : (1 << PIN["RP_INIT"]),
+	"RP_DONE" : (1 << PIN["RP_DONE"]),
+	"RP_G_CKSEL" : (1 << PIN["RP_G_CKSEL"]),
+
+	"RP_CD0" : (1 << PIN["RP_CD0"]),	// Output
+	"RP_CD1" : (1 << PIN["RP_CD1"]),
+	"RP_CD2" : (1 << PIN["RP_CD2"]),
+	"RP_CD3" : (1 << PIN["RP_CD3"]),
+	"RP_CD4" : (1 << PIN["RP_CD4"]),
+	"RP_CD5" : (1 << PIN["RP_CD5"]),
+	"RP_CD6" : (1 << PIN["RP_CD6"]),
+	"RP_CD7" : (1 << PIN["RP_CD7"]),
+	"RP_CD8" : (1 << PIN["RP_CD8"]),
+	"RP_CD9" : (1 << PIN["RP_CD9"]),
+	"RP_CD10" : (1 << PIN["RP_CD10"]),
+	"RP_CD11" : (1 << PIN["RP_CD11"]),
+	"RP_CD12" : (1 << PIN["RP_CD12"]),
+	"RP_CD13" : (1 << PIN["RP_CD13"]),
+	"RP_CD14" : (1 << PIN["RP_CD14"]),
+	"RP_CD15" : (1 << PIN["RP_CD15"]),
+	"RP_CD16" : (1 << PIN["RP_CD16"]),
+	"RP_CD17" : (1 << PIN["RP_CD17"]),
+
+	"RP_PROG" : (1 << PIN["RP_PROG"]),
+	"RP_CCLK" : (1 << PIN["RP_CCLK"]),
+	"RP_CSI" : (1 << PIN["RP_CSI"]),
+	"RP_RDWR" : (1 << PIN["RP_RDWR"]),
+}
+
+//-----------------------------------------------------------------------------
+const (
+	INIT_TIMEOUT = 10		// sec, INIT high after PROG pulse
+	DATA_TIMEOUT = 600		// sec, Sending bitstream
+	DONE_TIMEOUT = 10		// sec, DONE high after bitstream
+	POLL         = 10		// msec, INIT polling
+	CHECK_BYTES  = 64*1024		// Cancel check and progress interval while sending
+	CHECK_CLOCKS = 1024		// Cancel check interval while waiting DONE
+
+	DATA_MASK8  = 0x0000ff00	// RP_CD0-7
+	DATA_MASK16 = 0x00ffff00	// RP_CD0-15
+)
+
+var (
+	ErrWidth       = errors.New("SelectMAP width must be 8 or 16")
+	ErrOddSize     = errors.New("bitstream size must be even for x16 mode")
+	ErrInitTimeout = errors.New("configuration time out (init)")
+	ErrDataTimeout = errors.New("configuration time out (data)")
+	ErrDoneTimeout = errors.New("configuration time out (done)")
+	ErrInitLow     = errors.New("configuration error (while prog)")
+	ErrInitLowDone = errors.New("configuration error (while waiting)")
+	ErrCanceled    = errors.New("configuration canceled")
+)
+
+type Timeouts struct {
+	Init time.Duration	// INIT high after PROG pulse
+	Data time.Duration	// Sending bitstream
+	Done time.Duration	// DONE high after bitstream
+}
+
+var DefaultTimeouts = Timeouts{
+	Init: INIT_TIMEOUT * time.Second,
+	Data: DATA_TIMEOUT * time.Second,
+	Done: DONE_TIMEOUT * time.Second,
+}
+
+type Options struct {
+	Width    int		// 8 or 16
+	PR       bool		// Partial reconfiguration (no PROG pulse, no DONE wait)
+	Timeouts Timeouts	// Zero fields are DefaultTimeouts
+	Progress func(sent int, total int)	// Called every CHECK_BYTES and at the end
+}
+
+//-----------------------------------------------------------------------------
+// Pin setup
+//-----------------------------------------------------------------------------
+func data_mask(width int) uint32 {
+	if width == 8 {
+		return DATA_MASK8
+	}
+	return DATA_MASK16
+}
+
+func Init_pin(width int) {
+	gpio.Set_all_input()
+	for _, v := range PIN {
+		switch v {
+		// Set input
+		case PIN["RP_PWOK"], PIN["RP_INIT"], PIN["RP_DONE"], PIN["RP_G_CKSEL"]:
+			gpio.Set_input(v)
+
+		// Set output
+		// Negate before driving, the latch may be left low by comm and
+		// PROG_B low would clear the configuration in PR mode
+		case PIN["RP_PROG"], PIN["RP_CSI"], PIN["RP_RDWR"]:
+			gpio.Set_bus(1<<v)	// Negate
+			gpio.Set_output(v)
+
+		// Set output
+		case PIN["RP_CCLK"]:
+			gpio.Set_output(v)
+			gpio.Clr_bus(1<<v)	// Negate
+
+		default:
+			if (1<<v) & data_mask(width) != 0 {
+				gpio.Set_output(v)
+				gpio.Clr_bus(1<<v)	// Negate
+			}
+		}
+	}
+}
+
+// Stop driving the configuration bus (data and CCLK low, then all input)
+func Safe_pins(width int) {
+	gpio.Clr_bus(data_mask(width) | PIN_BIT["RP_CCLK"])
+	gpio.Set_all_input()
+}
+
+// INIT and DONE pin levels
+func Status()(init bool, done bool) {
+	return gpio.Get_pin(PIN["RP_INIT"]) == 1, gpio.Get_pin(PIN["RP_DONE"]) == 1
+}
+
+//-----------------------------------------------------------------------------
+// Phase checks
+//-----------------------------------------------------------------------------
+func check(ctx context.Context, deadline time.Time, timeout error) error {
+	if ctx.Err() != nil {
+		return ErrCanceled
+	}
+	if time.Now().After(deadline) {
+		return timeout
+	}
+	return nil
+}
+
+// Wait INIT high after PROG pulse
+func wait_init(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for gpio.Get_pin(PIN["RP_INIT"]) == 0 {
+		if err := check(ctx, deadline, ErrInitTimeout); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(POLL * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// Clock CCLK until DONE is asserted
+func wait_done(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for n := 0; gpio.Get_pin(PIN["RP_DONE"]) == 0; n++ {	// Wait until RP_DONE asserted
+		if gpio.Get_pin(PIN["RP_INIT"]) == 0 {
+			return ErrInitLowDone
+		}
+		if n % CHECK_CLOCKS == 0 {
+			if err := check(ctx, deadline, ErrDoneTimeout); err != nil {
+				return err
+			}
+		}
+		gpio.Set_bus(PIN_BIT["RP_CCLK"])
+		gpio.Clr_bus(PIN_BIT["RP_CCLK"])
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Program bitstream (.bin data)
+// Pins are left as input on return, also on error and cancel
+//-----------------------------------------------------------------------------
+func Program(ctx context.Context, bitstream []byte, opts Options) error {
+	if opts.Width != 8 && opts.Width != 16 {
+		return ErrWidth
+	}
+	if opts.Width == 16 && len(bitstream) % 2 != 0 {
+		return ErrOddSize
+	}
+
+	t := opts.Timeouts
+	if t.Init == 0 {
+		t.Init = DefaultTimeouts.Init
+	}
+	if t.Data == 0 {
+		t.Data = DefaultTimeouts.Data
+	}
+	if t.Done == 0 {
+		t.Done = DefaultTimeouts.Done
+	}
+
+	Init_pin(opts.Width)
+	defer Safe_pins(opts.Width)
+
+	// Invoke configuration
+	if opts.PR == false {
+		gpio.Set_bus(PIN_BIT["RP_PROG"]|PIN_BIT["RP_CSI"]|PIN_BIT["RP_RDWR"])	// Negate
+		gpio.Clr_bus(PIN_BIT["RP_PROG"]|PIN_BIT["RP_CSI"]|PIN_BIT["RP_RDWR"])	// Assert
+		gpio.Set_bus(PIN_BIT["RP_PROG"])					// Negate
+
+		if err := wait_init(ctx, t.Init); err != nil {
+			return err
+		}
+
+	} else {
+		gpio.Set_bus(PIN_BIT["RP_CSI"]|PIN_BIT["RP_RDWR"]) // Negate
+		gpio.Clr_bus(PIN_BIT["RP_CSI"]|PIN_BIT["RP_RDWR"]) // Assert
+	}
+
+	gpio.Clr_bus(PIN_BIT["RP_CCLK"])
+
+	mask := data_mask(opts.Width)
+	step := opts.Width / 8
+	total := len(bitstream)
+	deadline := time.Now().Add(t.Data)
+
+	for i := 0; i < total; i += step {
+		if i % CHECK_BYTES == 0 {
+			if err := check(ctx, deadline, ErrDataTimeout); err != nil {
+				return err
+			}
+			if opts.Progress != nil {
+				opts.Progress(i, total)
+			}
+		}
+
+		var data uint32
+		if step == 1 {
+			data = uint32(bitstream[i]) << 8
+		} else {
+			data = (uint32(bitstream[i+1]) << 8 | uint32(bitstream[i])) << 8
+		}
+		gpio.Clr_bus((^data & mask) | PIN_BIT["RP_CCLK"])
+		gpio.Set_bus(data & mask)
+		gpio.Set_bus(PIN_BIT["RP_CCLK"])
+
+		if gpio.Get_pin(PIN["RP_INIT"]) == 0 {
+			return ErrInitLow
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(total, total)
+	}
+
+	if opts.PR == false {
+		if err := wait_done(ctx, t.Done); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+// tls.go
+// nyacom (C) 2018.05
+// TLS for TCP listeners with optional client certificates
+// Certificates are reloaded on SIGHUP
+//-----------------------------------------------------------------------------
+package main
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// Client certificate mode
+const (
+	TLS_CLIENT_NONE     = "none"
+	TLS_CLIENT_OPTIONAL = "optional"	// Verify if presented
+	TLS_CLIENT_REQUIRE  = "require"
+)
+
+type TlsOpts struct {
+	Cert       string	// Server certificate (PEM)
+	Key        string	// Server key (PEM)
+	ClientCA   string	// CA bundle for client certificates (PEM)
+	ClientAuth string	// TLS_CLIENT_*
+}
+
+var (
+	tls_mu        sync.RWMutex
+	tls_opts      TlsOpts
+	tls_cert      *tls.Certificate
+	tls_client_ca *x509.CertPool
+)
+
+func tls_enabled() bool {
+	return tls_opts.Cert != ""
+}
+
+// Load certificates (at start and on SIGHUP)
+func tls_load() error {
+	if !tls_enabled() {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(tls_opts.Cert, tls_opts.Key)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if tls_opts.ClientCA != "" {
+		pem, err := os.ReadFile(tls_opts.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("No certificate in " + tls_opts.ClientCA)
+		}
+	}
+
+	tls_mu.Lock()
+	tls_cert = &cert
+	tls_client_ca = pool
+	tls_mu.Unlock()
+
+	fmt.Println("FiCDaemon: TLS certificate loaded", tls_opts.Cert)
+	return nil
+}
+
+func tls_setup(opts TlsOpts) error {
+	switch opts.ClientAuth {
+	case "":
+		opts.ClientAuth = TLS_CLIENT_NONE
+	case TLS_CLIENT_NONE, TLS_CLIENT_OPTIONAL, TLS_CLIENT_REQUIRE:
+	default:
+		return errors.New("Unknown client auth mode " + opts.ClientAuth)
+	}
+	if opts.Cert != "" && opts.Key == "" {
+		return errors.New("TLS key is not specified")
+	}
+	if opts.ClientAuth != TLS_CLIENT_NONE && opts.ClientCA == "" {
+		return errors.New("Client CA is required for client auth " + opts.ClientAuth)
+	}
+
+	tls_opts = opts
+	return tls_load()
+}
+
+// Server config, picks up reloaded certificates per handshake
+func tls_config()(*tls.Config) {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo)(*tls.Config, error) {
+			tls_mu.RLock()
+			defer tls_mu.RUnlock()
+
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*tls_cert},
+				ClientCAs:    tls_client_ca,
+				NextProtos:   []string{"h2"},	// gRPC
+			}
+			switch tls_opts.ClientAuth {
+			case TLS_CLIENT_OPTIONAL:
+				conf.ClientAuth = tls.VerifyClientCertIfGiven
+			case TLS_CLIENT_REQUIRE:
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
+
+// Listen with TLS if enabled
+func tls_listen(network string, addr string)(net.Listener, error) {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "tcp" && tls_enabled() {
+		return tls.NewListener(listener, tls_config()), nil
+	}
+	return listener, nil
+}
+
+// Create session for a connection, identified by client certificate if any
+func session_from_conn(conn net.Conn)(*Session, error) {
+	s := session_new(conn.RemoteAddr().String())
+
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return s, nil
+	}
+	// Silent clients must not hold the connection
+	tc.SetDeadline(time.Now().Add(TLS_HANDSHAKE_TIMEOUT * time.Second))
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	tc.SetDeadline(time.Time{})
+
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) > 0 {
+		if err := auth_login_cert(s, certs[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}